@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentialsReloader serves an ACL username and password, reading them from
+// mounted secret files again whenever a file changes on disk so that rotated
+// credentials are used for new connections without a restart. Values that are
+// not read from a file are served as configured.
+type credentialsReloader struct {
+	// name says whose credentials these are in log messages, e.g. "sentinel".
+	name string
+
+	usernameFile string
+	passwordFile string
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+	username string
+	password string
+}
+
+// reload reads the username and password files again when filesChanged
+// reports a change. On error the previously loaded credentials are kept.
+func (r *credentialsReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, changed, err := filesChanged(r.modTimes, r.usernameFile, r.passwordFile)
+	if err != nil || !changed {
+		return err
+	}
+
+	username, password := r.username, r.password
+	if r.usernameFile != "" {
+		value, err := readSecretFile(r.usernameFile)
+		if err != nil {
+			return err
+		}
+		username = value
+	}
+	if r.passwordFile != "" {
+		value, err := readSecretFile(r.passwordFile)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return fmt.Errorf("%s is empty", r.passwordFile)
+		}
+		password = value
+	}
+
+	if r.modTimes != nil {
+		slog.Info(fmt.Sprintf("Reloaded %s credentials", r.name))
+	}
+	r.modTimes = modTimes
+	r.username = username
+	r.password = password
+	return nil
+}
+
+// credentials returns the current username and password. It is used as the
+// CredentialsProvider of every client, so it runs for each new connection.
+func (r *credentialsReloader) credentials() (string, string) {
+	if err := r.reload(); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to reload %s credentials, using the previous ones", r.name), logKeyError, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.username, r.password
+}
+
+// readSecretFile returns the contents of a mounted secret without the trailing
+// newline that editors and `kubectl create secret --from-file` tend to leave.
+func readSecretFile(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// newNodeCredentials returns a credentialsReloader when the Valkey node
+// password is read from a file, or nil when it is given directly.
+func newNodeCredentials(config *Config) (*credentialsReloader, error) {
+	if config.NodePasswordFile == "" {
+		return nil, nil
+	}
+
+	reloader := &credentialsReloader{
+		name:         "node",
+		passwordFile: config.NodePasswordFile,
+		username:     config.NodeUsername,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load node credentials: %w", err)
+	}
+	return reloader, nil
+}
+
+// newSentinelCredentials returns a credentialsReloader when the username or
+// password is read from a file, or nil when both are given directly.
+func newSentinelCredentials(config *Config) (*credentialsReloader, error) {
+	if config.SentinelUsernameFile == "" && config.SentinelPasswordFile == "" {
+		return nil, nil
+	}
+
+	reloader := &credentialsReloader{
+		name:         "sentinel",
+		usernameFile: config.SentinelUsernameFile,
+		passwordFile: config.SentinelPasswordFile,
+		username:     config.SentinelUsername,
+		password:     config.SentinelPassword,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load sentinel credentials: %w", err)
+	}
+	return reloader, nil
+}
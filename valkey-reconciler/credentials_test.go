@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSentinelCredentialsWithoutFiles(t *testing.T) {
+	credentials, err := newSentinelCredentials(&Config{SentinelUsername: "reconciler", SentinelPassword: "secret"})
+	if err != nil || credentials != nil {
+		t.Errorf("newSentinelCredentials() without files = (%v, %v), want (nil, nil)", credentials, err)
+	}
+}
+
+func TestNewSentinelCredentialsReloadsFiles(t *testing.T) {
+	dir := t.TempDir()
+	usernameFile := filepath.Join(dir, "username")
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(usernameFile, []byte("reconciler\n"), 0o600); err != nil {
+		t.Fatalf("failed to write username: %v", err)
+	}
+	if err := os.WriteFile(passwordFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password: %v", err)
+	}
+
+	credentials, err := newSentinelCredentials(&Config{SentinelUsernameFile: usernameFile, SentinelPasswordFile: passwordFile})
+	if err != nil {
+		t.Fatalf("newSentinelCredentials() unexpected error: %v", err)
+	}
+	if username, password := credentials.credentials(); username != "reconciler" || password != "first" {
+		t.Errorf("credentials() = (%q, %q), want (%q, %q)", username, password, "reconciler", "first")
+	}
+
+	// Rotate the password, as kubelet does when the mounted secret changes.
+	if err := os.WriteFile(passwordFile, []byte("second\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(passwordFile, future, future); err != nil {
+		t.Fatalf("failed to touch password: %v", err)
+	}
+	if username, password := credentials.credentials(); username != "reconciler" || password != "second" {
+		t.Errorf("credentials() after rotation = (%q, %q), want (%q, %q)", username, password, "reconciler", "second")
+	}
+
+	// A file that disappears mid-rotation keeps the previous credentials.
+	if err := os.Remove(passwordFile); err != nil {
+		t.Fatalf("failed to remove password: %v", err)
+	}
+	if username, password := credentials.credentials(); username != "reconciler" || password != "second" {
+		t.Errorf("credentials() with missing file = (%q, %q), want (%q, %q)", username, password, "reconciler", "second")
+	}
+}
+
+func TestNewSentinelCredentialsPasswordFromEnv(t *testing.T) {
+	usernameFile := filepath.Join(t.TempDir(), "username")
+	if err := os.WriteFile(usernameFile, []byte("reconciler"), 0o600); err != nil {
+		t.Fatalf("failed to write username: %v", err)
+	}
+
+	credentials, err := newSentinelCredentials(&Config{SentinelUsernameFile: usernameFile, SentinelPassword: "secret"})
+	if err != nil {
+		t.Fatalf("newSentinelCredentials() unexpected error: %v", err)
+	}
+	if username, password := credentials.credentials(); username != "reconciler" || password != "secret" {
+		t.Errorf("credentials() = (%q, %q), want (%q, %q)", username, password, "reconciler", "secret")
+	}
+}
+
+func TestNodeCredentialsLogAsNode(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("secret"), 0o600); err != nil {
+		t.Fatalf("failed to write password: %v", err)
+	}
+	credentials, err := newNodeCredentials(&Config{NodePasswordFile: passwordFile})
+	if err != nil {
+		t.Fatalf("newNodeCredentials() unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(newLogger(&buf, slog.LevelInfo, logFormatText))
+
+	if err := os.Remove(passwordFile); err != nil {
+		t.Fatalf("failed to remove password: %v", err)
+	}
+	credentials.credentials()
+	if got := buf.String(); !strings.Contains(got, "Failed to reload node credentials") {
+		t.Errorf("log = %q, want a node credentials warning", got)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// masterServicePortName names the port of the master Service the reconciler
+// creates. EndpointSlice ports are matched to Service ports by name.
+const masterServicePortName = "valkey"
+
+// masterEndpointsCache holds the master Services and EndpointSlices labelled
+// as managed by the reconciler, so reconciling them reads nothing from the
+// API server.
+type masterEndpointsCache struct {
+	services corelisters.ServiceLister
+	slices   discoverylisters.EndpointSliceLister
+	synced   []cache.InformerSynced
+}
+
+// newMasterEndpointsCache returns a cache of the managed master Services and
+// EndpointSlices in namespace, or in every namespace when it is empty. The
+// informers are started by the caller through the returned factory.
+func newMasterEndpointsCache(clientset kubernetes.Interface, namespace string) (*masterEndpointsCache, informers.SharedInformerFactory) {
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelManagedBy: eventComponent})
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector.String()
+		}),
+	)
+	services := factory.Core().V1().Services()
+	slices := factory.Discovery().V1().EndpointSlices()
+	return &masterEndpointsCache{
+		services: services.Lister(),
+		slices:   slices.Lister(),
+		synced:   []cache.InformerSynced{services.Informer().HasSynced, slices.Informer().HasSynced},
+	}, factory
+}
+
+// usesMasterService reports whether any master group routes through a master
+// Service, and so needs the master endpoints cache.
+func usesMasterService(config *Config) bool {
+	for _, group := range config.Masters {
+		if group.MasterServiceName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// setMasterEndpoints points the EndpointSlice of the group's master Service at
+// pod on the port sentinel reported, or leaves it without endpoints when pod
+// is nil. Routing then changes with a single write instead of waiting for the
+// endpoints controller to follow the master label. It reports whether the
+// EndpointSlice was written.
+func (r *Reconciler) setMasterEndpoints(ctx context.Context, pod *corev1.Pod, masterAddress []string) (bool, error) {
+	group := r.group
+	port, err := strconv.ParseInt(masterAddress[1], 10, 32)
+	if err != nil {
+		return false, fmt.Errorf("invalid master port %q: %w", masterAddress[1], err)
+	}
+	if r.masterEndpoints == nil {
+		return false, fmt.Errorf("no master endpoints cache for Service %s", group.MasterServiceName)
+	}
+
+	service, err := r.ensureMasterService(ctx, int32(port))
+	if err != nil {
+		return false, err
+	}
+
+	slice := r.masterEndpointSlice(service, pod, masterAddress[0], int32(port))
+	current, err := r.masterEndpoints.slices.EndpointSlices(r.config.Namespace).Get(slice.Name)
+	switch {
+	case apierrors.IsNotFound(err):
+		current = nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get EndpointSlice %s: %w", slice.Name, err)
+	case current.AddressType == slice.AddressType &&
+		reflect.DeepEqual(current.Endpoints, slice.Endpoints) &&
+		reflect.DeepEqual(current.Ports, slice.Ports):
+		return false, nil
+	}
+
+	if r.config.DryRun {
+		r.logger().Info("Dry run: would update master endpoints", "service", group.MasterServiceName, "endpoints", endpointAddresses(slice))
+		return true, nil
+	}
+
+	slices := r.clientset.DiscoveryV1().EndpointSlices(r.config.Namespace)
+	switch {
+	case current == nil:
+		_, err = slices.Create(ctx, slice, metav1.CreateOptions{})
+	case current.AddressType != slice.AddressType:
+		// The address type of an EndpointSlice is immutable, so a master in
+		// the other IP family needs a new slice.
+		if err = slices.Delete(ctx, slice.Name, metav1.DeleteOptions{}); err == nil {
+			_, err = slices.Create(ctx, slice, metav1.CreateOptions{})
+		}
+	default:
+		slice.ResourceVersion = current.ResourceVersion
+		_, err = slices.Update(ctx, slice, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update EndpointSlice %s: %w", slice.Name, err)
+	}
+	r.logger().Info("Updated master endpoints", "service", group.MasterServiceName, "endpoints", endpointAddresses(slice))
+	return true, nil
+}
+
+// ensureMasterService returns the group's master Service, creating it without
+// a selector when it does not exist. An existing Service with a selector is
+// rejected, as the endpoints controller would add every selected pod to it.
+// The cache only holds Services labelled as managed by the reconciler, so a
+// Service created by someone else must carry that label too.
+func (r *Reconciler) ensureMasterService(ctx context.Context, port int32) (*corev1.Service, error) {
+	name := r.group.MasterServiceName
+	service, err := r.masterEndpoints.services.Services(r.config.Namespace).Get(name)
+	if err == nil {
+		return checkMasterService(service)
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get master Service %s: %w", name, err)
+	}
+
+	service = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: r.config.Namespace,
+			Labels:    map[string]string{discoveryv1.LabelManagedBy: eventComponent},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{
+				Name:       masterServicePortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       port,
+				TargetPort: intstr.FromInt32(port),
+			}},
+		},
+	}
+	if r.config.DryRun {
+		r.logger().Info("Dry run: would create master Service", "service", name)
+		return service, nil
+	}
+	services := r.clientset.CoreV1().Services(r.config.Namespace)
+	created, err := services.Create(ctx, service, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// Either the cache has not seen our own Service yet, or the Service
+		// lacks the label that would put it in the cache.
+		existing, err := services.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get master Service %s: %w", name, err)
+		}
+		if existing.Labels[discoveryv1.LabelManagedBy] != eventComponent {
+			return nil, fmt.Errorf("master Service %s must be labelled %s=%s", name, discoveryv1.LabelManagedBy, eventComponent)
+		}
+		return checkMasterService(existing)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create master Service %s: %w", name, err)
+	}
+	r.logger().Info("Created master Service", "service", name)
+	return created, nil
+}
+
+// checkMasterService rejects a master Service with a selector.
+func checkMasterService(service *corev1.Service) (*corev1.Service, error) {
+	if len(service.Spec.Selector) > 0 {
+		return nil, fmt.Errorf("master Service %s must not have a selector", service.Name)
+	}
+	return service, nil
+}
+
+// masterEndpointSlice builds the EndpointSlice of service with pod as its only
+// endpoint. The address sentinel reported is used when it is an IP, otherwise
+// the pod's primary IP.
+func (r *Reconciler) masterEndpointSlice(service *corev1.Service, pod *corev1.Pod, address string, port int32) *discoveryv1.EndpointSlice {
+	portName := masterServicePortName
+	if len(service.Spec.Ports) > 0 {
+		portName = service.Spec.Ports[0].Name
+	}
+	protocol := corev1.ProtocolTCP
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      service.Name,
+			Namespace: service.Namespace,
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: service.Name,
+				discoveryv1.LabelManagedBy:   eventComponent,
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   []discoveryv1.Endpoint{},
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Protocol: &protocol, Port: &port}},
+	}
+	if service.UID != "" {
+		slice.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(service, corev1.SchemeGroupVersion.WithKind("Service"))}
+	}
+	if pod == nil {
+		return slice
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		if ips := podIPs(pod); len(ips) > 0 {
+			ip = ips[0]
+		}
+	}
+	if ip == nil {
+		return slice
+	}
+	if ip.To4() == nil {
+		slice.AddressType = discoveryv1.AddressTypeIPv6
+	}
+
+	ready := true
+	endpoint := discoveryv1.Endpoint{
+		Addresses:  []string{ip.String()},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		TargetRef: &corev1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			UID:       pod.UID,
+		},
+	}
+	if pod.Spec.NodeName != "" {
+		endpoint.NodeName = &pod.Spec.NodeName
+	}
+	slice.Endpoints = append(slice.Endpoints, endpoint)
+	return slice
+}
+
+// endpointAddresses lists the addresses of slice for logging.
+func endpointAddresses(slice *discoveryv1.EndpointSlice) []string {
+	var addresses []string
+	for _, endpoint := range slice.Endpoints {
+		addresses = append(addresses, endpoint.Addresses...)
+	}
+	return addresses
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newEndpointSliceReconciler(t *testing.T, config *Config, pods ...*corev1.Pod) *testReconciler {
+	t.Helper()
+
+	r := newTestReconciler(t, config, pods...)
+	r.group.MasterServiceName = "valkey-master"
+	return r
+}
+
+func getMasterEndpointSlice(t *testing.T, r *testReconciler) *discoveryv1.EndpointSlice {
+	t.Helper()
+
+	slice, err := r.client.DiscoveryV1().EndpointSlices("default").Get(context.Background(), "valkey-master", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get EndpointSlice: %v", err)
+	}
+	return slice
+}
+
+func TestSetCurrentMasterEndpointSlice(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newEndpointSliceReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", nil),
+	)
+
+	ctx := context.Background()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+
+	service, err := r.client.CoreV1().Services("default").Get(ctx, "valkey-master", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("master Service was not created: %v", err)
+	}
+	if len(service.Spec.Selector) != 0 {
+		t.Errorf("master Service selector = %v, want none", service.Spec.Selector)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != 6379 {
+		t.Errorf("master Service ports = %+v, want 6379", service.Spec.Ports)
+	}
+
+	slice := getMasterEndpointSlice(t, r)
+	if got := slice.Labels[discoveryv1.LabelServiceName]; got != "valkey-master" {
+		t.Errorf("EndpointSlice service label = %q, want valkey-master", got)
+	}
+	if len(slice.Endpoints) != 1 || slice.Endpoints[0].Addresses[0] != "10.244.1.5" {
+		t.Fatalf("EndpointSlice endpoints = %+v, want 10.244.1.5", slice.Endpoints)
+	}
+	if ref := slice.Endpoints[0].TargetRef; ref == nil || ref.Name != "valkey-0" {
+		t.Errorf("EndpointSlice target = %+v, want valkey-0", ref)
+	}
+	if len(slice.Ports) != 1 || *slice.Ports[0].Port != 6379 || *slice.Ports[0].Name != masterServicePortName {
+		t.Errorf("EndpointSlice ports = %+v, want %s 6379", slice.Ports, masterServicePortName)
+	}
+
+	// A failover moves the endpoint with a single update.
+	r.syncCache(t)
+	r.client.ClearActions()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.6", "6380"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	// The EndpointSlice is written before any label, and the Service and
+	// EndpointSlice are read from the cache only.
+	actions := r.client.Actions()
+	if len(actions) == 0 || actions[0].GetVerb() != "update" || actions[0].GetResource().Resource != "endpointslices" {
+		t.Errorf("first action on failover = %v, want an update of the EndpointSlice", actions)
+	}
+	for _, action := range actions {
+		if action.GetResource().Resource == "endpointslices" && action.GetVerb() != "update" {
+			t.Errorf("unexpected %s of the EndpointSlice on failover", action.GetVerb())
+		}
+		if action.GetResource().Resource == "services" {
+			t.Errorf("unexpected %s of the master Service on failover", action.GetVerb())
+		}
+	}
+	slice = getMasterEndpointSlice(t, r)
+	if len(slice.Endpoints) != 1 || slice.Endpoints[0].Addresses[0] != "10.244.1.6" || *slice.Ports[0].Port != 6380 {
+		t.Errorf("EndpointSlice after failover = %+v %+v, want 10.244.1.6:6380", slice.Endpoints, slice.Ports)
+	}
+
+	// Nothing is read or written while the endpoints are current.
+	r.syncCache(t)
+	r.client.ClearActions()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.6", "6380"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	if actions := r.client.Actions(); len(actions) != 0 {
+		t.Errorf("unexpected API calls when nothing changed: %v", actions)
+	}
+}
+
+func TestSetCurrentMasterEndpointSliceBeforeVerifiedPromotion(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		VerifyMasterRole:    true,
+	}
+	r := newEndpointSliceReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", nil),
+	)
+	roleChecks := 0
+	r.nodeRole = func(ctx context.Context, addr string) (string, error) {
+		roleChecks++
+		if addr == "10.244.1.6:6379" {
+			return "master", nil
+		}
+		return "slave", nil
+	}
+
+	ctx := context.Background()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.6", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	r.syncCache(t)
+
+	// A candidate that reports the replica role gets neither the endpoint
+	// nor the label, and the current master keeps both.
+	roleChecks = 0
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err == nil {
+		t.Fatal("setCurrentMaster() expected an error for a pod reporting the replica role")
+	}
+	if roleChecks != 1 {
+		t.Errorf("role checked %d times, want once", roleChecks)
+	}
+	if slice := getMasterEndpointSlice(t, r); len(slice.Endpoints) != 1 || slice.Endpoints[0].Addresses[0] != "10.244.1.6" {
+		t.Errorf("EndpointSlice endpoints = %+v after an unverified failover, want 10.244.1.6", slice.Endpoints)
+	}
+}
+
+func TestSetCurrentMasterEndpointSliceWhileMasterDown(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newEndpointSliceReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-master": "true"}),
+		newValkeyPod("valkey-1", "10.244.1.6", nil),
+	)
+
+	ctx := context.Background()
+	if _, err := r.markMasterDown(ctx, []string{"10.244.1.5", "6379"}, "test"); err != nil {
+		t.Fatalf("markMasterDown() unexpected error: %v", err)
+	}
+	if slice := getMasterEndpointSlice(t, r); len(slice.Endpoints) != 0 {
+		t.Errorf("EndpointSlice endpoints = %+v while the master is down, want none", slice.Endpoints)
+	}
+}
+
+func TestSetCurrentMasterEndpointSliceIPv6(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newEndpointSliceReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "fd00::6", nil),
+	)
+
+	ctx := context.Background()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	r.syncCache(t)
+	if _, err := r.setCurrentMaster(ctx, []string{"fd00::6", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+
+	slice := getMasterEndpointSlice(t, r)
+	if slice.AddressType != discoveryv1.AddressTypeIPv6 {
+		t.Errorf("EndpointSlice address type = %s, want %s", slice.AddressType, discoveryv1.AddressTypeIPv6)
+	}
+	if len(slice.Endpoints) != 1 || slice.Endpoints[0].Addresses[0] != "fd00::6" {
+		t.Errorf("EndpointSlice endpoints = %+v, want fd00::6", slice.Endpoints)
+	}
+}
+
+func TestSetCurrentMasterEndpointSliceDryRun(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterName:          "dryrun-endpoints",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		DryRun:              true,
+	}
+	r := newEndpointSliceReconciler(t, config, newValkeyPod("valkey-0", "10.244.1.5", nil))
+
+	if _, err := r.setCurrentMaster(context.Background(), []string{"10.244.1.5", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	for _, action := range r.client.Actions() {
+		if _, ok := action.(k8stesting.CreateAction); ok {
+			t.Errorf("setCurrentMaster() created a %s in dry-run mode", action.GetResource().Resource)
+		}
+	}
+}
+
+func TestEnsureMasterServiceRejectsSelector(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newEndpointSliceReconciler(t, config)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "valkey-master", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"vk-master": "true"}},
+	}
+	if _, err := r.client.CoreV1().Services("default").Create(context.Background(), service, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create Service: %v", err)
+	}
+
+	// Without the managed-by label the Service is not in the cache.
+	_, err := r.ensureMasterService(context.Background(), 6379)
+	if err == nil || !strings.Contains(err.Error(), discoveryv1.LabelManagedBy) {
+		t.Errorf("ensureMasterService() error = %v, want a label error", err)
+	}
+
+	service.Labels = map[string]string{discoveryv1.LabelManagedBy: eventComponent}
+	if _, err := r.client.CoreV1().Services("default").Update(context.Background(), service, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update Service: %v", err)
+	}
+	r.syncCache(t)
+	_, err = r.ensureMasterService(context.Background(), 6379)
+	if err == nil || !strings.Contains(err.Error(), "selector") {
+		t.Errorf("ensureMasterService() error = %v, want a selector error", err)
+	}
+}
+
+func TestEnsureMasterServiceNotYetCached(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newEndpointSliceReconciler(t, config)
+
+	// The second call runs before the cache has seen the first Service.
+	ctx := context.Background()
+	if _, err := r.ensureMasterService(ctx, 6379); err != nil {
+		t.Fatalf("ensureMasterService() unexpected error: %v", err)
+	}
+	if _, err := r.ensureMasterService(ctx, 6379); err != nil {
+		t.Errorf("ensureMasterService() unexpected error before the cache synced: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// eventComponent is the source reported on the Events the reconciler
+	// records.
+	eventComponent = "valkey-reconciler"
+
+	eventReasonMasterPromoted     = "MasterPromoted"
+	eventReasonMasterDemoted      = "MasterDemoted"
+	eventReasonMasterRoleMismatch = "MasterRoleMismatch"
+)
+
+// newEventRecorder returns a recorder that writes Kubernetes Events to the
+// namespace of the object they are about, and the broadcaster behind it so the
+// caller can flush it on shutdown.
+func newEventRecorder(config *Config, clientset kubernetes.Interface) (record.EventBroadcaster, record.EventRecorder) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent, Host: config.PodName})
+	return broadcaster, recorder
+}
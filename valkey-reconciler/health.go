@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// healthState tracks what /readyz reports. A replica that is not the active
+// reconciler (a leader election standby) is always ready, since it has nothing
+// to subscribe to until it acquires the Lease.
+type healthState struct {
+	mu     sync.Mutex
+	active bool
+	// masters lists the "namespace/name" keys that must each have reconciled.
+	masters []string
+	// subscribed holds the state of the sentinel subscription per namespace.
+	subscribed map[string]bool
+	// reconciled holds the result of the last reconciliation per master key.
+	reconciled map[string]error
+}
+
+var health = &healthState{}
+
+func (h *healthState) setActive(active bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.active = active
+	if !active {
+		h.subscribed = nil
+		h.reconciled = nil
+	}
+}
+
+// expectMasters adds master keys that must each have reconciled for the
+// replica to be ready.
+func (h *healthState) expectMasters(keys ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.masters = append(h.masters, keys...)
+}
+
+// forgetNamespace drops everything recorded for namespace once the reconciler
+// no longer serves it.
+func (h *healthState) forgetNamespace(namespace string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prefix := namespace + "/"
+	masters := h.masters[:0]
+	for _, key := range h.masters {
+		if !strings.HasPrefix(key, prefix) {
+			masters = append(masters, key)
+		}
+	}
+	h.masters = masters
+	delete(h.subscribed, namespace)
+	for key := range h.reconciled {
+		if strings.HasPrefix(key, prefix) {
+			delete(h.reconciled, key)
+		}
+	}
+}
+
+func (h *healthState) setSubscribed(namespace string, subscribed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribed == nil {
+		h.subscribed = make(map[string]bool)
+	}
+	h.subscribed[namespace] = subscribed
+}
+
+func (h *healthState) recordReconcile(key string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.reconciled == nil {
+		h.reconciled = make(map[string]error)
+	}
+	h.reconciled[key] = err
+}
+
+// ready returns nil when the replica can be considered ready, or the reason it
+// is not.
+func (h *healthState) ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.active {
+		return nil
+	}
+	if len(h.masters) > 0 && len(h.subscribed) == 0 {
+		return errors.New("not subscribed to sentinel events")
+	}
+	for namespace, subscribed := range h.subscribed {
+		if !subscribed {
+			return fmt.Errorf("not subscribed to sentinel events for namespace %s", namespace)
+		}
+	}
+	for _, key := range h.masters {
+		if _, ok := h.reconciled[key]; !ok {
+			return fmt.Errorf("no reconciliation of %s has completed yet", key)
+		}
+	}
+	for key, err := range h.reconciled {
+		if err != nil {
+			return fmt.Errorf("last reconciliation of %s failed: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
+
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := health.ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "ok")
+}
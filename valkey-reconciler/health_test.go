@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthStateReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		active      bool
+		subscribed  bool
+		reconciled  bool
+		reconcile   error
+		expectReady bool
+	}{
+		{
+			name:        "standby replica is ready",
+			active:      false,
+			expectReady: true,
+		},
+		{
+			name:        "active but not subscribed",
+			active:      true,
+			subscribed:  false,
+			reconciled:  true,
+			expectReady: false,
+		},
+		{
+			name:        "subscribed but never reconciled",
+			active:      true,
+			subscribed:  true,
+			expectReady: false,
+		},
+		{
+			name:        "subscribed with failed reconciliation",
+			active:      true,
+			subscribed:  true,
+			reconciled:  true,
+			reconcile:   errors.New("forbidden"),
+			expectReady: false,
+		},
+		{
+			name:        "subscribed with successful reconciliation",
+			active:      true,
+			subscribed:  true,
+			reconciled:  true,
+			expectReady: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &healthState{}
+			h.expectMasters("default/myprimary")
+			h.setActive(tt.active)
+			h.setSubscribed("default", tt.subscribed)
+			if tt.reconciled {
+				h.recordReconcile("default/myprimary", tt.reconcile)
+			}
+
+			err := h.ready()
+			if tt.expectReady && err != nil {
+				t.Errorf("ready() = %v, want nil", err)
+			}
+			if !tt.expectReady && err == nil {
+				t.Errorf("ready() = nil, want error")
+			}
+		})
+	}
+}
+
+func TestHealthStateDeactivateResets(t *testing.T) {
+	h := &healthState{}
+	h.expectMasters("default/myprimary")
+	h.setActive(true)
+	h.setSubscribed("default", true)
+	h.recordReconcile("default/myprimary", nil)
+	h.setActive(false)
+	h.setActive(true)
+
+	if err := h.ready(); err == nil {
+		t.Errorf("ready() after regaining leadership = nil, want error until resubscribed")
+	}
+}
+
+func TestHealthStateRequiresEveryMaster(t *testing.T) {
+	h := &healthState{}
+	h.expectMasters("default/first", "default/second")
+	h.setActive(true)
+	h.setSubscribed("default", true)
+
+	h.recordReconcile("default/first", nil)
+	if err := h.ready(); err == nil {
+		t.Errorf("ready() with second master unreconciled = nil, want error")
+	}
+
+	h.recordReconcile("default/second", errors.New("forbidden"))
+	if err := h.ready(); err == nil {
+		t.Errorf("ready() with second master failing = nil, want error")
+	}
+
+	h.recordReconcile("default/second", nil)
+	if err := h.ready(); err != nil {
+		t.Errorf("ready() with all masters reconciled = %v, want nil", err)
+	}
+}
+
+func TestHealthStateForgetNamespace(t *testing.T) {
+	h := &healthState{}
+	h.setActive(true)
+	if err := h.ready(); err != nil {
+		t.Errorf("ready() with no namespaces served = %v, want nil", err)
+	}
+
+	h.expectMasters("team-a/myprimary", "team-b/myprimary")
+	h.setSubscribed("team-a", true)
+	h.setSubscribed("team-b", false)
+	h.recordReconcile("team-a/myprimary", nil)
+	h.recordReconcile("team-b/myprimary", errors.New("forbidden"))
+	if err := h.ready(); err == nil {
+		t.Errorf("ready() with team-b failing = nil, want error")
+	}
+
+	h.forgetNamespace("team-b")
+	if err := h.ready(); err != nil {
+		t.Errorf("ready() after forgetting team-b = %v, want nil", err)
+	}
+}
+
+func TestProbeEndpoints(t *testing.T) {
+	previous := health
+	defer func() { health = previous }()
+
+	health = &healthState{}
+	health.expectMasters("default/myprimary")
+	health.setActive(true)
+
+	handler := newHTTPHandler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != 200 {
+		t.Errorf("GET /healthz status = %d, want 200", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != 503 {
+		t.Errorf("GET /readyz before subscription status = %d, want 503", recorder.Code)
+	}
+
+	health.setSubscribed("default", true)
+	health.recordReconcile("default/myprimary", nil)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != 200 {
+		t.Errorf("GET /readyz after subscription status = %d, want 200", recorder.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// runWithLeaderElection blocks until ctx is cancelled, invoking run only while
+// this replica holds the Lease. Losing the Lease without a shutdown request
+// terminates the process so that no two replicas write pod labels at once.
+func runWithLeaderElection(ctx context.Context, config *Config, clientset kubernetes.Interface, run func(ctx context.Context)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      config.LeaseName,
+			Namespace: config.Namespace,
+		},
+		Client: clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: config.PodName,
+		},
+	}
+
+	slog.Info("Starting leader election", "lease", config.Namespace+"/"+config.LeaseName, "identity", config.PodName)
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   config.LeaseDuration,
+		RenewDeadline:   config.RenewDeadline,
+		RetryPeriod:     config.RetryPeriod,
+		Name:            config.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				slog.Info("Acquired leadership, starting reconciler")
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					slog.Info("Released leadership on shutdown")
+					return
+				}
+				fatal("Lost leadership, exiting")
+			},
+			OnNewLeader: func(identity string) {
+				if identity == config.PodName {
+					return
+				}
+				slog.Info("Following the current leader", "leader", identity)
+			},
+		},
+	})
+}
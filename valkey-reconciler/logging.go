@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Attribute keys shared by every log record, so log queries can filter on
+// them regardless of which component wrote the line.
+const (
+	logKeyNamespace    = "namespace"
+	logKeyMasterName   = "master_name"
+	logKeyMasterAddr   = "master_addr"
+	logKeyPod          = "pod"
+	logKeyEventChannel = "event_channel"
+	logKeySentinel     = "sentinel"
+	logKeyReason       = "reason"
+	logKeyError        = "error"
+)
+
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// parseLogLevel parses LOG_LEVEL: debug, info, warn or error.
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be debug, info, warn or error", envLogLevel, value)
+	}
+	return level, nil
+}
+
+// parseLogFormat parses LOG_FORMAT: json or text.
+func parseLogFormat(value string) (string, error) {
+	format := strings.ToLower(value)
+	if format != logFormatJSON && format != logFormatText {
+		return "", fmt.Errorf("invalid %s %q: must be %s or %s", envLogFormat, value, logFormatJSON, logFormatText)
+	}
+	return format, nil
+}
+
+// newLogger returns a logger writing records at or above level to w in the
+// given format.
+func newLogger(w io.Writer, level slog.Level, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if format == logFormatText {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// masterAddr formats a sentinel master address for the master_addr attribute.
+func masterAddr(address []string) string {
+	if len(address) < 2 {
+		return strings.Join(address, ":")
+	}
+	return address[0] + ":" + address[1]
+}
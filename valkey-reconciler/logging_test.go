@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    slog.Level
+		expectError bool
+	}{
+		{value: "debug", expected: slog.LevelDebug},
+		{value: "info", expected: slog.LevelInfo},
+		{value: "WARN", expected: slog.LevelWarn},
+		{value: "error", expected: slog.LevelError},
+		{value: "verbose", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			level, err := parseLogLevel(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("parseLogLevel(%q) expected error, but got none", tt.value)
+				}
+				return
+			}
+			if err != nil || level != tt.expected {
+				t.Errorf("parseLogLevel(%q) = (%v, %v), want (%v, nil)", tt.value, level, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelInfo, logFormatJSON)
+
+	logger.Debug("Received sentinel message", logKeyEventChannel, "+sdown")
+	logger.Info("Pod is the master, promoting", logKeyMasterName, "myprimary", logKeyPod, "valkey-0")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d log lines, want 1 (debug filtered out): %q", len(lines), buf.String())
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	for key, want := range map[string]string{
+		"level":          "INFO",
+		"msg":            "Pod is the master, promoting",
+		logKeyMasterName: "myprimary",
+		logKeyPod:        "valkey-0",
+	} {
+		if record[key] != want {
+			t.Errorf("record[%q] = %v, want %q", key, record[key], want)
+		}
+	}
+}
+
+func TestNewLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelDebug, logFormatText)
+
+	logger.Debug("Received sentinel message", logKeyEventChannel, "+sdown")
+
+	if got := buf.String(); !strings.Contains(got, "level=DEBUG") || !strings.Contains(got, "event_channel=+sdown") {
+		t.Errorf("text log line = %q, want debug record with event_channel", got)
+	}
+}
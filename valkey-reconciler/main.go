@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/redis/go-redis/v9"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -19,6 +25,9 @@ import (
 // SentinelClient interface for testing
 type SentinelClient interface {
 	GetMasterAddrByName(ctx context.Context, name string) *redis.StringSliceCmd
+	Replicas(ctx context.Context, name string) *redis.MapStringStringSliceCmd
+	Sentinels(ctx context.Context, name string) *redis.MapStringStringSliceCmd
+	Master(ctx context.Context, name string) *redis.MapStringStringCmd
 }
 
 const (
@@ -26,45 +35,402 @@ const (
 	envValkeySentinelPort     = "VALKEY_SENTINEL_PORT"
 	envValkeySentinelHost     = "VALKEY_SENTINEL_HOST"
 	envValkeySentinelPassword = "VALKEY_SENTINEL_PASSWORD"
+	envSentinelPasswordFile   = "VALKEY_SENTINEL_PASSWORD_FILE"
+	envSentinelUsername       = "VALKEY_SENTINEL_USERNAME"
+	envSentinelUsernameFile   = "VALKEY_SENTINEL_USERNAME_FILE"
+	envValkeySentinelAddrs    = "VALKEY_SENTINEL_ADDRS"
+	envValkeySentinelDiscover = "VALKEY_SENTINEL_DISCOVER"
+	envValkeySentinelQuorum   = "VALKEY_SENTINEL_QUORUM"
+	envSentinelTLS            = "VALKEY_SENTINEL_TLS_ENABLED"
+	envSentinelTLSCAFile      = "VALKEY_SENTINEL_TLS_CA_FILE"
+	envSentinelTLSCertFile    = "VALKEY_SENTINEL_TLS_CERT_FILE"
+	envSentinelTLSKeyFile     = "VALKEY_SENTINEL_TLS_KEY_FILE"
+	envSentinelServerName     = "VALKEY_SENTINEL_TLS_SERVER_NAME"
+	envSentinelTLSInsecure    = "VALKEY_SENTINEL_TLS_INSECURE_SKIP_VERIFY"
 	envValkeyMasterName       = "VALKEY_MASTER_NAME"
+	envValkeyMasters          = "VALKEY_MASTERS"
 	envPodNamespace           = "POD_NAMESPACE"
+	envValkeyPodSelector      = "VALKEY_POD_SELECTOR"
+	envWatchNamespaces        = "WATCH_NAMESPACES"
+	envSentinelAllowedHosts   = "VALKEY_SENTINEL_ALLOWED_HOSTS"
 	envMasterPodLabelName     = "MASTER_POD_LABEL_NAME"
 	envMasterPodLabelValue    = "MASTER_POD_LABEL_VALUE"
+	envReplicaPodLabelValue   = "REPLICA_POD_LABEL_VALUE"
+	envHealthyReplicaLabel    = "HEALTHY_REPLICA_LABEL_NAME"
+	envHealthyReplicaValue    = "HEALTHY_REPLICA_LABEL_VALUE"
+	envMasterServiceName      = "MASTER_SERVICE_NAME"
+	envPodName                = "POD_NAME"
+	envLeaderElection         = "LEADER_ELECTION_ENABLED"
+	envLeaseName              = "LEADER_ELECTION_LEASE_NAME"
+	envLeaseDuration          = "LEADER_ELECTION_LEASE_DURATION"
+	envRenewDeadline          = "LEADER_ELECTION_RENEW_DEADLINE"
+	envRetryPeriod            = "LEADER_ELECTION_RETRY_PERIOD"
+	envHTTPListenAddr         = "HTTP_LISTEN_ADDR"
+	envResyncInterval         = "RESYNC_INTERVAL"
+	envDryRun                 = "DRY_RUN"
+	envDropMasterOnODown      = "DROP_MASTER_LABEL_ON_ODOWN"
+	envVerifyMasterRole       = "VALKEY_VERIFY_MASTER_ROLE"
+	envNodeUsername           = "VALKEY_NODE_USERNAME"
+	envNodePassword           = "VALKEY_NODE_PASSWORD"
+	envNodePasswordFile       = "VALKEY_NODE_PASSWORD_FILE"
+	envNodeTLS                = "VALKEY_NODE_TLS_ENABLED"
+	envNodeServerName         = "VALKEY_NODE_TLS_SERVER_NAME"
+	envLogLevel               = "LOG_LEVEL"
+	envLogFormat              = "LOG_FORMAT"
 )
 
 type Config struct {
-	SentinelPort        string
-	SentinelHost        string
-	SentinelPassword    string
-	ServiceName         string
-	MasterName          string
-	Namespace           string
-	MasterPodLabelName  string
-	MasterPodLabelValue string
+	SentinelPort         string
+	SentinelHost         string
+	SentinelUsername     string
+	SentinelUsernameFile string
+	SentinelPassword     string
+	SentinelPasswordFile string
+	SentinelCredentials  *credentialsReloader
+	SentinelAddrs        []string
+	SentinelDiscovery    bool
+	SentinelQuorum       int
+	SentinelTLS          bool
+	SentinelTLSCAFile    string
+	SentinelTLSCertFile  string
+	SentinelTLSKeyFile   string
+	SentinelServerName   string
+	SentinelTLSInsecure  bool
+	SentinelTLSConfig    *tls.Config
+	ServiceName          string
+	MasterName           string
+	Namespace            string
+	WatchNamespaces      []string
+	SentinelAllowedHosts []string
+	PodSelector          string
+	MasterPodLabelName   string
+	MasterPodLabelValue  string
+	ReplicaPodLabelValue string
+	HealthyReplicaLabel  string
+	HealthyReplicaValue  string
+	MasterServiceName    string
+	PodName              string
+	LeaderElection       bool
+	LeaseName            string
+	LeaseDuration        time.Duration
+	RenewDeadline        time.Duration
+	RetryPeriod          time.Duration
+	HTTPListenAddr       string
+	ResyncInterval       time.Duration
+	DryRun               bool
+	DropMasterOnODown    bool
+	VerifyMasterRole     bool
+	NodeUsername         string
+	NodePassword         string
+	NodePasswordFile     string
+	NodeCredentials      *credentialsReloader
+	NodeTLS              bool
+	NodeServerName       string
+	NodeTLSConfig        *tls.Config
+	LogLevel             slog.Level
+	LogFormat            string
+	Masters              []MasterGroup
+}
+
+// defaultPodSelector selects the Valkey pods whose labels the reconciler
+// manages when VALKEY_POD_SELECTOR is not set. Requiring the instance label
+// keeps pods that are not part of a Helm release out of the way.
+const defaultPodSelector = "app.kubernetes.io/name=valkey,app.kubernetes.io/instance"
+
+// MasterGroup is one sentinel master name together with the pods that serve it
+// and the labels the reconciler maintains on them. Fields left empty in
+// VALKEY_MASTERS fall back to the corresponding single-master variables.
+type MasterGroup struct {
+	Name                 string `json:"name"`
+	PodSelector          string `json:"podSelector"`
+	MasterPodLabelName   string `json:"masterLabelName"`
+	MasterPodLabelValue  string `json:"masterLabelValue"`
+	ReplicaPodLabelValue string `json:"replicaLabelValue"`
+	HealthyReplicaLabel  string `json:"healthyReplicaLabelName"`
+	HealthyReplicaValue  string `json:"healthyReplicaLabelValue"`
+	MasterServiceName    string `json:"masterServiceName"`
 }
 
 func getConfig() (*Config, error) {
 	config := &Config{
-		SentinelPort:        getEnvOrDefault(envValkeySentinelPort, "26379"),
-		SentinelHost:        getEnvOrDefault(envValkeySentinelHost, ""),
-		SentinelPassword:    getEnvOrDefault(envValkeySentinelPassword, ""),
-		MasterName:          getEnvOrDefault(envValkeyMasterName, "myprimary"),
-		Namespace:           getEnvOrDefault(envPodNamespace, "default"),
-		MasterPodLabelName:  getEnvOrDefault(envMasterPodLabelName, "valkey-master"),
-		MasterPodLabelValue: getEnvOrDefault(envMasterPodLabelValue, "true"),
+		SentinelPort:         getEnvOrDefault(envValkeySentinelPort, "26379"),
+		SentinelHost:         getEnvOrDefault(envValkeySentinelHost, ""),
+		SentinelUsername:     getEnvOrDefault(envSentinelUsername, ""),
+		SentinelUsernameFile: getEnvOrDefault(envSentinelUsernameFile, ""),
+		SentinelPassword:     getEnvOrDefault(envValkeySentinelPassword, ""),
+		SentinelPasswordFile: getEnvOrDefault(envSentinelPasswordFile, ""),
+		SentinelTLSCAFile:    getEnvOrDefault(envSentinelTLSCAFile, ""),
+		SentinelTLSCertFile:  getEnvOrDefault(envSentinelTLSCertFile, ""),
+		SentinelTLSKeyFile:   getEnvOrDefault(envSentinelTLSKeyFile, ""),
+		SentinelServerName:   getEnvOrDefault(envSentinelServerName, ""),
+		MasterName:           getEnvOrDefault(envValkeyMasterName, "myprimary"),
+		Namespace:            getEnvOrDefault(envPodNamespace, "default"),
+		PodSelector:          getEnvOrDefault(envValkeyPodSelector, defaultPodSelector),
+		MasterPodLabelName:   getEnvOrDefault(envMasterPodLabelName, "valkey-master"),
+		MasterPodLabelValue:  getEnvOrDefault(envMasterPodLabelValue, "true"),
+		ReplicaPodLabelValue: getEnvOrDefault(envReplicaPodLabelValue, ""),
+		HealthyReplicaLabel:  getEnvOrDefault(envHealthyReplicaLabel, ""),
+		HealthyReplicaValue:  getEnvOrDefault(envHealthyReplicaValue, "true"),
+		MasterServiceName:    getEnvOrDefault(envMasterServiceName, ""),
+		PodName:              getEnvOrDefault(envPodName, ""),
+		LeaseName:            getEnvOrDefault(envLeaseName, "valkey-reconciler"),
+		HTTPListenAddr:       getEnvOrDefault(envHTTPListenAddr, ":8080"),
+		NodeUsername:         getEnvOrDefault(envNodeUsername, ""),
+		NodePassword:         getEnvOrDefault(envNodePassword, ""),
+		NodePasswordFile:     getEnvOrDefault(envNodePasswordFile, ""),
 	}
 
-	if config.SentinelHost == "" {
-		return nil, fmt.Errorf("%s environment variable is required", envValkeySentinelHost)
+	var err error
+	if config.LeaderElection, err = getEnvBoolOrDefault(envLeaderElection, false); err != nil {
+		return nil, err
+	}
+	if config.LeaseDuration, err = getEnvDurationOrDefault(envLeaseDuration, 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.RenewDeadline, err = getEnvDurationOrDefault(envRenewDeadline, 7*time.Second); err != nil {
+		return nil, err
+	}
+	if config.RetryPeriod, err = getEnvDurationOrDefault(envRetryPeriod, 2*time.Second); err != nil {
+		return nil, err
+	}
+	if config.ResyncInterval, err = getEnvDurationOrDefault(envResyncInterval, 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.DryRun, err = getEnvBoolOrDefault(envDryRun, false); err != nil {
+		return nil, err
+	}
+	if config.DropMasterOnODown, err = getEnvBoolOrDefault(envDropMasterOnODown, false); err != nil {
+		return nil, err
+	}
+	if config.VerifyMasterRole, err = getEnvBoolOrDefault(envVerifyMasterRole, false); err != nil {
+		return nil, err
+	}
+	if config.LogLevel, err = parseLogLevel(getEnvOrDefault(envLogLevel, "info")); err != nil {
+		return nil, err
+	}
+	if config.LogFormat, err = parseLogFormat(getEnvOrDefault(envLogFormat, logFormatJSON)); err != nil {
+		return nil, err
 	}
 
-	if config.SentinelPassword == "" {
-		return nil, fmt.Errorf("%s environment variable is required", envValkeySentinelPassword)
+	if config.SentinelTLS, err = getEnvBoolOrDefault(envSentinelTLS, true); err != nil {
+		return nil, err
+	}
+	if config.SentinelTLSInsecure, err = getEnvBoolOrDefault(envSentinelTLSInsecure, false); err != nil {
+		return nil, err
+	}
+	if config.SentinelDiscovery, err = getEnvBoolOrDefault(envValkeySentinelDiscover, false); err != nil {
+		return nil, err
+	}
+	if config.SentinelQuorum, err = getEnvIntOrDefault(envValkeySentinelQuorum, 0); err != nil {
+		return nil, err
+	}
+	if config.SentinelAddrs, err = getSentinelAddrs(); err != nil {
+		return nil, err
+	}
+	if config.WatchNamespaces, err = getWatchNamespaces(); err != nil {
+		return nil, err
+	}
+	config.SentinelAllowedHosts = getSentinelAllowedHosts()
+
+	// With WATCH_NAMESPACES the sentinel of a namespace may instead be
+	// discovered from a pod annotation.
+	if config.SentinelHost == "" && len(config.SentinelAddrs) == 0 && len(config.WatchNamespaces) == 0 {
+		return nil, fmt.Errorf("%s or %s environment variable is required", envValkeySentinelHost, envValkeySentinelAddrs)
+	}
+
+	if config.SentinelPassword == "" && config.SentinelPasswordFile == "" {
+		return nil, fmt.Errorf("%s or %s environment variable is required", envValkeySentinelPassword, envSentinelPasswordFile)
+	}
+	if config.SentinelPassword != "" && config.SentinelPasswordFile != "" {
+		return nil, fmt.Errorf("%s and %s cannot both be set", envValkeySentinelPassword, envSentinelPasswordFile)
+	}
+	if config.SentinelUsername != "" && config.SentinelUsernameFile != "" {
+		return nil, fmt.Errorf("%s and %s cannot both be set", envSentinelUsername, envSentinelUsernameFile)
+	}
+	if config.SentinelCredentials, err = newSentinelCredentials(config); err != nil {
+		return nil, err
+	}
+
+	// The Valkey nodes are checked with the sentinel credentials unless node
+	// credentials are given, since a least-privilege sentinel user rarely
+	// exists on the nodes.
+	if config.NodeUsername == "" && config.NodePassword == "" && config.NodePasswordFile == "" {
+		config.NodeUsername = config.SentinelUsername
+		config.NodePassword = config.SentinelPassword
+		config.NodeCredentials = config.SentinelCredentials
+	} else {
+		if config.NodePassword != "" && config.NodePasswordFile != "" {
+			return nil, fmt.Errorf("%s and %s cannot both be set", envNodePassword, envNodePasswordFile)
+		}
+		if config.NodeCredentials, err = newNodeCredentials(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := labels.Parse(config.PodSelector); err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", envValkeyPodSelector, config.PodSelector, err)
+	}
+
+	if config.Masters, err = getMasterGroups(config); err != nil {
+		return nil, err
+	}
+
+	if (config.SentinelTLSCertFile == "") != (config.SentinelTLSKeyFile == "") {
+		return nil, fmt.Errorf("%s and %s must be set together", envSentinelTLSCertFile, envSentinelTLSKeyFile)
+	}
+	if config.SentinelTLSConfig, err = newSentinelTLSConfig(config); err != nil {
+		return nil, err
+	}
+	if config.NodeTLS, err = getEnvBoolOrDefault(envNodeTLS, config.SentinelTLS); err != nil {
+		return nil, err
+	}
+	config.NodeServerName = getEnvOrDefault(envNodeServerName, config.SentinelServerName)
+	if config.NodeTLSConfig, err = newNodeTLSConfig(config); err != nil {
+		return nil, err
+	}
+
+	if config.LeaderElection {
+		if config.PodName == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return nil, fmt.Errorf("%s is not set and hostname is unavailable: %v", envPodName, err)
+			}
+			config.PodName = hostname
+		}
+		if config.RenewDeadline >= config.LeaseDuration {
+			return nil, fmt.Errorf("%s must be shorter than %s", envRenewDeadline, envLeaseDuration)
+		}
 	}
 
 	return config, nil
 }
 
+// getSentinelAddrs parses VALKEY_SENTINEL_ADDRS, a comma-separated list of
+// host:port sentinel addresses.
+func getSentinelAddrs() ([]string, error) {
+	value := os.Getenv(envValkeySentinelAddrs)
+	if value == "" {
+		return nil, nil
+	}
+
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid sentinel address %q in %s: %v", addr, envValkeySentinelAddrs, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// getWatchNamespaces parses WATCH_NAMESPACES, a comma-separated list of
+// namespaces or "*" for all namespaces. An empty result means only
+// POD_NAMESPACE is served.
+func getWatchNamespaces() ([]string, error) {
+	value := os.Getenv(envWatchNamespaces)
+	if value == "" {
+		return nil, nil
+	}
+
+	var namespaces []string
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	for _, namespace := range namespaces {
+		if namespace == allNamespaces && len(namespaces) > 1 {
+			return nil, fmt.Errorf("%s cannot combine %q with other namespaces", envWatchNamespaces, allNamespaces)
+		}
+	}
+	return namespaces, nil
+}
+
+// getSentinelAllowedHosts parses VALKEY_SENTINEL_ALLOWED_HOSTS, a
+// comma-separated list of hosts outside their own namespace that pods may name
+// in sentinelAddressAnnotation.
+func getSentinelAllowedHosts() []string {
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv(envSentinelAllowedHosts), ",") {
+		host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// getMasterGroups parses VALKEY_MASTERS, filling unset fields from the
+// single-master configuration. Without VALKEY_MASTERS it returns a single group
+// built from VALKEY_MASTER_NAME and the label variables.
+func getMasterGroups(config *Config) ([]MasterGroup, error) {
+	groups := []MasterGroup{{}}
+	if value := os.Getenv(envValkeyMasters); value != "" {
+		groups = nil
+		if err := json.Unmarshal([]byte(value), &groups); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", envValkeyMasters, err)
+		}
+		if len(groups) == 0 {
+			return nil, fmt.Errorf("%s must list at least one master", envValkeyMasters)
+		}
+		for i, group := range groups {
+			if group.Name == "" {
+				return nil, fmt.Errorf("%s entry %d has no name", envValkeyMasters, i)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	services := make(map[string]string)
+	for i := range groups {
+		group := &groups[i]
+		group.Name = stringOrDefault(group.Name, config.MasterName)
+		group.PodSelector = stringOrDefault(group.PodSelector, config.PodSelector)
+		group.MasterPodLabelName = stringOrDefault(group.MasterPodLabelName, config.MasterPodLabelName)
+		group.MasterPodLabelValue = stringOrDefault(group.MasterPodLabelValue, config.MasterPodLabelValue)
+		group.ReplicaPodLabelValue = stringOrDefault(group.ReplicaPodLabelValue, config.ReplicaPodLabelValue)
+		group.HealthyReplicaLabel = stringOrDefault(group.HealthyReplicaLabel, config.HealthyReplicaLabel)
+		group.HealthyReplicaValue = stringOrDefault(group.HealthyReplicaValue, config.HealthyReplicaValue)
+		group.MasterServiceName = stringOrDefault(group.MasterServiceName, config.MasterServiceName)
+
+		if _, err := labels.Parse(group.PodSelector); err != nil {
+			return nil, fmt.Errorf("master %s: invalid podSelector %q: %v", group.Name, group.PodSelector, err)
+		}
+		if seen[group.Name] {
+			return nil, fmt.Errorf("master %s is listed more than once", group.Name)
+		}
+		seen[group.Name] = true
+
+		if group.ReplicaPodLabelValue == group.MasterPodLabelValue {
+			return nil, fmt.Errorf("master %s: %s must differ from %s", group.Name, envReplicaPodLabelValue, envMasterPodLabelValue)
+		}
+		if group.HealthyReplicaLabel != "" && group.HealthyReplicaLabel == group.MasterPodLabelName {
+			return nil, fmt.Errorf("master %s: %s must differ from %s", group.Name, envHealthyReplicaLabel, envMasterPodLabelName)
+		}
+		if group.MasterServiceName != "" {
+			if other, ok := services[group.MasterServiceName]; ok {
+				return nil, fmt.Errorf("masters %s and %s both use the master Service %s", other, group.Name, group.MasterServiceName)
+			}
+			services[group.MasterServiceName] = group.Name
+		}
+	}
+
+	return groups, nil
+}
+
+func stringOrDefault(value, defaultValue string) string {
+	if value != "" {
+		return value
+	}
+	return defaultValue
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -72,192 +438,562 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-func getCurrentMaster(ctx context.Context, config *Config) ([]string, error) {
-	sentinel := redis.NewSentinelClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", config.SentinelHost, config.SentinelPort),
-		Password: config.SentinelPassword,
-		TLSConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	})
+func getEnvBoolOrDefault(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean for %s: %q", key, value)
+	}
+	return parsed, nil
+}
+
+func getEnvIntOrDefault(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid integer for %s: %q", key, value)
+	}
+	return parsed, nil
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid duration for %s: %q", key, value)
+	}
+	return parsed, nil
+}
+
+// sentinelOptions returns the connection options shared by every sentinel
+// client.
+func sentinelOptions(config *Config, addr string) *redis.Options {
+	options := &redis.Options{
+		Addr:      addr,
+		Username:  config.SentinelUsername,
+		Password:  config.SentinelPassword,
+		TLSConfig: sentinelTLSConfig(config, addr),
+	}
+	if config.SentinelCredentials != nil {
+		options.CredentialsProvider = config.SentinelCredentials.credentials
+	}
+	return options
+}
+
+func newSentinelClient(config *Config, addr string) *redis.SentinelClient {
+	return redis.NewSentinelClient(sentinelOptions(config, addr))
+}
+
+// getCurrentMaster asks every known sentinel for the address of masterName and
+// returns the one a quorum of them agrees on.
+func getCurrentMaster(ctx context.Context, config *Config, masterName string) ([]string, error) {
+	addrs := sentinelAddresses(ctx, config, masterName)
+	sentinels := make(map[string]SentinelClient, len(addrs))
+	for _, addr := range addrs {
+		sentinel := newSentinelClient(config, addr)
+		defer sentinel.Close()
+		sentinels[addr] = sentinel
+	}
 
-	log.Printf("Searching for current master at host: %s, port: %s, master name: %s", config.SentinelHost, config.SentinelPort, config.MasterName)
-	return getCurrentMasterFromSentinel(ctx, config, sentinel)
+	quorum := sentinelQuorum(config, len(sentinels))
+	slog.Debug("Searching for current master", logKeyMasterName, masterName, "sentinels", addrs, "quorum", quorum)
+	return masterByQuorum(ctx, masterName, sentinels, quorum)
 }
 
-func getCurrentMasterFromSentinel(ctx context.Context, config *Config, sentinel SentinelClient) ([]string, error) {
-	masterAddress, err := sentinel.GetMasterAddrByName(ctx, config.MasterName).Result()
+func getCurrentMasterFromSentinel(ctx context.Context, masterName string, sentinel SentinelClient) ([]string, error) {
+	masterAddress, err := sentinel.GetMasterAddrByName(ctx, masterName).Result()
 
 	if err != nil {
-		log.Printf("Failed to get current master: %v", err)
+		slog.Warn("Failed to get current master", logKeyMasterName, masterName, logKeyError, err)
 		return masterAddress, err
 	}
 
 	return masterAddress, nil
 }
 
+// getHealthyReplicas asks the configured sentinels in turn for the healthy
+// replicas of masterName and returns the first answer.
+func getHealthyReplicas(ctx context.Context, config *Config, masterName string) ([]string, error) {
+	var err error
+	for _, addr := range sentinelSeeds(config) {
+		sentinel := newSentinelClient(config, addr)
+		var healthy []string
+		healthy, err = getHealthyReplicasFromSentinel(ctx, masterName, sentinel)
+		sentinel.Close()
+		if err == nil {
+			return healthy, nil
+		}
+	}
+	return nil, err
+}
 
-func setCurrentMaster(ctx context.Context, config *Config, masterAddress []string) {
-
-	masterIp, err := net.LookupIP(masterAddress[0])
+// getHealthyReplicasFromSentinel returns the addresses of the replicas that
+// sentinel considers online and in sync with the master.
+func getHealthyReplicasFromSentinel(ctx context.Context, masterName string, sentinel SentinelClient) ([]string, error) {
+	replicas, err := sentinel.Replicas(ctx, masterName).Result()
 	if err != nil {
-		log.Fatalf("Failed to lookup master IP: %v", err)
+		return nil, fmt.Errorf("failed to get replicas: %w", err)
 	}
 
-	// Create Kubernetes client
-	k8sConfig, err := rest.InClusterConfig()
-	if err != nil {
-		log.Fatalf("Failed to get Kubernetes config: %v", err)
+	var healthy []string
+	for _, replica := range replicas {
+		if isHealthyReplica(replica) {
+			healthy = append(healthy, net.JoinHostPort(replica["ip"], replica["port"]))
+		} else {
+			slog.Debug("Replica is not healthy", logKeyMasterName, masterName, "replica_addr", net.JoinHostPort(replica["ip"], replica["port"]),
+				"flags", replica["flags"], "master_link_status", replica["master-link-status"])
+		}
 	}
+	return healthy, nil
+}
 
-	clientset, err := kubernetes.NewForConfig(k8sConfig)
+// getDownMaster asks every known sentinel for the flags of masterName and
+// returns the master's address when any of them flags it as objectively down,
+// or an empty string when none does. A seed such as a headless Service is
+// resolved first, so each sentinel behind it is asked rather than whichever
+// one a connection happens to reach.
+func getDownMaster(ctx context.Context, config *Config, masterName string) (string, error) {
+	var addrs []string
+	for _, addr := range sentinelAddresses(ctx, config, masterName) {
+		addrs = append(addrs, resolveSeed(addr)...)
+	}
+	addrs = uniqueAddresses(addrs)
+
+	var errs []error
+	for _, addr := range addrs {
+		sentinel := newSentinelClient(config, addr)
+		down, err := getDownMasterFromSentinel(ctx, masterName, sentinel)
+		sentinel.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+			continue
+		}
+		if down != "" {
+			return down, nil
+		}
+	}
+	if len(errs) == len(addrs) {
+		return "", errors.Join(errs...)
+	}
+	return "", nil
+}
+
+// getDownMasterFromSentinel reads the flags of SENTINEL MASTER and returns
+// the master's address when they include o_down.
+func getDownMasterFromSentinel(ctx context.Context, masterName string, sentinel SentinelClient) (string, error) {
+	master, err := sentinel.Master(ctx, masterName).Result()
 	if err != nil {
-		log.Fatalf("Failed to create Kubernetes client: %v", err)
+		return "", fmt.Errorf("failed to get master state: %w", err)
 	}
+	for _, flag := range strings.Split(master["flags"], ",") {
+		if flag == "o_down" {
+			return masterAddr([]string{master["ip"], master["port"]}), nil
+		}
+	}
+	return "", nil
+}
 
-	log.Printf("Setting current master to %s:%s", masterAddress[0], masterAddress[1])
+// isHealthyReplica reports whether a SENTINEL REPLICAS entry describes a
+// reachable replica with a working link to the master.
+func isHealthyReplica(replica map[string]string) bool {
+	if replica["ip"] == "" || replica["master-link-status"] != "ok" {
+		return false
+	}
 
-	pods, err := clientset.CoreV1().Pods(config.Namespace).List(context.Background(), metav1.ListOptions{
-		LabelSelector: "app.kubernetes.io/name=valkey",
-	})
+	isSlave := false
+	for _, flag := range strings.Split(replica["flags"], ",") {
+		switch flag {
+		case "slave":
+			isSlave = true
+		case "s_down", "o_down", "disconnected":
+			return false
+		}
+	}
+	return isSlave
+}
 
+func newKubernetesClient() (kubernetes.Interface, error) {
+	k8sConfig, err := rest.InClusterConfig()
 	if err != nil {
-		log.Fatalf("Failed to list pods: %v", err)
+		return nil, fmt.Errorf("failed to get Kubernetes config: %w", err)
 	}
 
-	log.Printf("Found %d pods with label app.kubernetes.io/name=valkey", len(pods.Items))
-
-	for _, pod := range pods.Items {
+	return kubernetes.NewForConfig(k8sConfig)
+}
 
-		targetIP := net.ParseIP(pod.Status.PodIP)
-		if targetIP == nil {
-			log.Printf("Invalid pod IP: %s", pod.Status.PodIP)
-			continue
-		}
-		if targetIP.Equal(masterIp[0]) {
-			log.Printf("Pod %s is the master", pod.Name)
-			pod.Labels[config.MasterPodLabelName] = config.MasterPodLabelValue
-			_, err := clientset.CoreV1().Pods(config.Namespace).Update(context.Background(), &pod, metav1.UpdateOptions{})
-			if err != nil {
-				log.Printf("Failed to label pod %s as master: %v", pod.Name, err)
-				continue
-			}
-		} else if pod.Labels[config.MasterPodLabelName] == config.MasterPodLabelValue {
-			log.Printf("Pod %s was the master, removing label", pod.Name)
-			pod.Labels[config.MasterPodLabelName] = ""
-			_, err := clientset.CoreV1().Pods(config.Namespace).Update(context.Background(), &pod, metav1.UpdateOptions{})
-			if err != nil {
-				log.Printf("Failed to remove label from pod %s: %v", pod.Name, err)
-				continue
-			}
-		} else {
-			log.Printf("Pod %s is not the master", pod.Name)
+// eventMasterName returns the master name a sentinel instance event refers to.
+// Events about a master are formatted "master <name> <ip> <port>", events about
+// replicas and sentinels end with "@ <master-name> <master-ip> <master-port>".
+func eventMasterName(payload string) (string, bool) {
+	fields := strings.Fields(payload)
+	if len(fields) >= 2 && fields[0] == "master" {
+		return fields[1], true
+	}
+	for i, field := range fields {
+		if field == "@" && i+1 < len(fields) {
+			return fields[i+1], true
 		}
 	}
+	return "", false
+}
 
+// sentinelChannels are the sentinel pub/sub channels the event loop
+// subscribes to.
+var sentinelChannels = []string{
+	"+switch-master",
+	"+reboot",
+	"+odown", "-odown",
+	"+sdown", "-sdown",
+	"+failover-end",
+	"+slave",
+	"+convert-to-slave",
+	"+role-change",
 }
 
-func listenForSwitchMasterEvents(ctx context.Context, config *Config, currentMaster []string) {
+// sentinelEvent is an instance event published by sentinel, such as +sdown or
+// +role-change, about a master, replica or sentinel of masterName.
+type sentinelEvent struct {
+	channel      string
+	instanceType string
+	masterName   string
+	address      []string
+}
 
-	for {
+// parseSentinelEvent parses the payload of an instance event. It reports false
+// when the payload does not name a master.
+func parseSentinelEvent(channel, payload string) (sentinelEvent, bool) {
+	masterName, ok := eventMasterName(payload)
+	if !ok {
+		return sentinelEvent{}, false
+	}
+	fields := strings.Fields(payload)
+	event := sentinelEvent{
+		channel:      channel,
+		instanceType: fields[0],
+		masterName:   masterName,
+	}
+	if len(fields) >= 4 {
+		event.address = fields[2:4]
+	}
+	return event, true
+}
 
-		log.Printf("Connecting to sentinel at %s:%s", config.SentinelHost, config.SentinelPort)
-		sentinel := redis.NewSentinelClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%s", config.SentinelHost, config.SentinelPort),
-			Password: config.SentinelPassword,
-			TLSConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			MaxRetries:  -1,
-			ReadTimeout: 1 * time.Second,
-			OnConnect: func(ctx context.Context, cn *redis.Conn) error {
-				log.Printf("Connection established")
+// resyncReason returns why event calls for reconciling the pods of group, or
+// an empty string when it does not. Events that change which instance is the
+// master are followed by a resync; replica events only matter when group
+// maintains a healthy replica label.
+func resyncReason(event sentinelEvent, group MasterGroup) string {
+	isMaster := event.instanceType == "master"
+	isReplica := event.instanceType == "slave"
+	tracksReplicas := group.HealthyReplicaLabel != ""
+
+	switch event.channel {
+	case "+reboot":
+		return "reboot event"
+	case "-odown":
+		if isMaster {
+			return "master no longer objectively down"
+		}
+	case "-sdown":
+		if isMaster {
+			return "master no longer subjectively down"
+		}
+		if isReplica && tracksReplicas {
+			return "replica no longer subjectively down"
+		}
+	case "+sdown":
+		if isReplica && tracksReplicas {
+			return "replica subjectively down"
+		}
+	case "+failover-end":
+		return "failover ended"
+	case "+slave":
+		if tracksReplicas {
+			return "replica discovered"
+		}
+	case "+convert-to-slave":
+		return "instance converted to replica"
+	case "+role-change":
+		return "instance role changed"
+	}
+	return ""
+}
 
-				currentMaster, err := getCurrentMaster(ctx, config)
-				if err != nil {
-					log.Printf("Failed to get current master: %v", err)
-					return nil
-				}
+// resyncAll re-reads the master of every group from sentinel and reconciles
+// their pods.
+func resyncAll(ctx context.Context, reconcilers map[string]*Reconciler, reason string) {
+	for _, reconciler := range reconcilers {
+		reconciler.resync(ctx, reason)
+	}
+}
 
-				log.Printf("Current master: %v", currentMaster)
+// listenForSwitchMasterEvents follows one sentinel at a time, moving on to the
+// next configured address whenever the connection is lost.
+func listenForSwitchMasterEvents(ctx context.Context, config *Config, reconcilers map[string]*Reconciler) {
+	seeds := sentinelSeeds(config)
+	logger := slog.With(logKeyNamespace, config.Namespace)
 
-				setCurrentMaster(ctx, config, currentMaster)
+	for attempt := 0; ctx.Err() == nil; attempt++ {
+		if attempt > 0 {
+			sentinelReconnectsTotal.Inc()
+		}
 
-				return nil
-			},
-		})
+		addr := seeds[attempt%len(seeds)]
+		logger := logger.With(logKeySentinel, addr)
+		logger.Info("Connecting to sentinel")
+		options := sentinelOptions(config, addr)
+		options.MaxRetries = -1
+		options.ReadTimeout = 1 * time.Second
+		options.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+			logger.Info("Connection established")
+			// A -odown may have been missed while disconnected; the resync
+			// reads the current state from sentinel instead.
+			for _, reconciler := range reconcilers {
+				reconciler.markMasterUp()
+			}
+			resyncAll(ctx, reconcilers, "sentinel connected")
+			return nil
+		}
+		sentinel := redis.NewSentinelClient(options)
 
 		_, pingErr := sentinel.Ping(ctx).Result()
 		if pingErr != nil {
-			log.Printf("Failed to ping sentinel: %v", pingErr)
-			time.Sleep(1 * time.Second)
+			logger.Warn("Failed to ping sentinel", logKeyError, pingErr)
+			sentinel.Close()
+			sleepWithContext(ctx, 1*time.Second)
 			continue
 		}
 
-		log.Printf("Listening for switch-master events")
+		logger.Debug("Subscribing to sentinel events")
 
-		pubsub := sentinel.PSubscribe(ctx, "*")
+		pubsub := sentinel.Subscribe(ctx, sentinelChannels...)
 
 		_, err := pubsub.Receive(ctx)
 		if err != nil {
-			log.Fatalf("Failed to receive event: %v", err)
+			logger.Warn("Failed to subscribe to sentinel events", logKeyError, err)
+			pubsub.Close()
+			sentinel.Close()
+			sleepWithContext(ctx, 1*time.Second)
 			continue
 		}
 
-		log.Printf("Subscribed to switch-master events")
+		logger.Info("Subscribed to sentinel events")
+		health.setSubscribed(config.Namespace, true)
+
+		// Consume messages until the channel closes or the context is cancelled.
+		channel := pubsub.Channel(redis.WithChannelHealthCheckInterval(1 * time.Second))
+	consume:
+		for {
+			var msg *redis.Message
+			var ok bool
+			select {
+			case <-ctx.Done():
+				break consume
+			case msg, ok = <-channel:
+				if !ok {
+					break consume
+				}
+			}
+
+			logger.Debug("Received sentinel message", logKeyEventChannel, msg.Channel, "payload", msg.Payload)
 
-		// Consume messages.
-		for msg := range pubsub.Channel(redis.WithChannelHealthCheckInterval(1 * time.Second)) {
-			log.Printf("Received %s message %s", msg.Channel, msg.Payload)
+			sentinelEventsTotal.WithLabelValues(msg.Channel).Inc()
 
 			if msg.Channel == "+switch-master" {
 				parts := strings.Fields(msg.Payload)
 				if len(parts) != 5 {
-					log.Printf("Invalid switch-master event format: %d", len(parts))
-					for _, line := range parts {
-						log.Printf("\tLine: %s", line)
-					}
+					logger.Warn("Invalid switch-master event format", logKeyEventChannel, msg.Channel, "payload", msg.Payload)
+					continue
+				}
+				reconciler, ok := reconcilers[parts[0]]
+				if !ok {
+					logger.Debug("Ignoring event for unmanaged master", logKeyEventChannel, msg.Channel, logKeyMasterName, parts[0])
 					continue
 				}
-				setCurrentMaster(ctx, config, parts[3:5])
-			} else if msg.Channel == "+reboot" {
-				log.Printf("Received reboot event, fetching current master")
-				currentMaster, err := getCurrentMaster(ctx, config)
+				// The event comes from a single sentinel, which may be
+				// partitioned from the others.
+				logger := logger.With(logKeyEventChannel, msg.Channel, logKeyMasterName, parts[0])
+				logger.Info("Master switched", "old_master_addr", masterAddr(parts[1:3]), logKeyMasterAddr, masterAddr(parts[3:5]))
+				masterAddress, err := confirmMaster(ctx, config, parts[0], parts[3:5])
 				if err != nil {
-					log.Printf("Failed to get current master after reboot event: %v", err)
+					logger.Error("Failed to confirm switch-master event", logKeyError, err)
 					continue
 				}
-				log.Printf("Current master after reboot: %v", currentMaster)
-				setCurrentMaster(ctx, config, currentMaster)
+				if _, err := reconciler.reconcileWithRetry(ctx, masterAddress, "+switch-master event"); err != nil {
+					logger.Error("Failed to set current master after switch-master event", logKeyMasterAddr, masterAddr(masterAddress), logKeyError, err)
+				}
 			} else {
-				// log.Printf("Received %s message %s", msg.Channel, msg.Payload)
+				handleSentinelEvent(ctx, logger, reconcilers, msg)
 			}
 		}
 
+		health.setSubscribed(config.Namespace, false)
 		pubsub.Close()
 		sentinel.Close()
-		log.Printf("Connection to sentinel lost, reconnecting")
+		if ctx.Err() != nil {
+			break
+		}
+		logger.Warn("Connection to sentinel lost, reconnecting")
+
+		sleepWithContext(ctx, 2*time.Second)
+	}
+
+	logger.Info("Stopped listening for sentinel events")
+}
+
+// handleSentinelEvent acts on an instance event: it logs a master going down,
+// removes its master label with DROP_MASTER_LABEL_ON_ODOWN, and resyncs the
+// master group when resyncReason asks for it.
+func handleSentinelEvent(ctx context.Context, logger *slog.Logger, reconcilers map[string]*Reconciler, msg *redis.Message) {
+	logger = logger.With(logKeyEventChannel, msg.Channel)
+
+	event, ok := parseSentinelEvent(msg.Channel, msg.Payload)
+	if !ok {
+		if msg.Channel == "+reboot" {
+			logger.Info("Received reboot event, fetching current masters")
+			resyncAll(ctx, reconcilers, "reboot event")
+			return
+		}
+		logger.Warn("Invalid sentinel event format", "payload", msg.Payload)
+		return
+	}
+
+	reconciler, ok := reconcilers[event.masterName]
+	if !ok {
+		logger.Debug("Ignoring event for unmanaged master", logKeyMasterName, event.masterName)
+		return
+	}
+	logger = logger.With(logKeyMasterName, event.masterName, "instance_type", event.instanceType, "instance_addr", masterAddr(event.address))
+
+	if event.instanceType == "master" {
+		switch event.channel {
+		case "+odown":
+			if !reconciler.config.DropMasterOnODown || len(event.address) < 2 {
+				logger.Warn("Master is objectively down, waiting for failover")
+				break
+			}
+			logger.Warn("Master is objectively down, removing master label until failover")
+			if _, err := reconciler.markMasterDown(ctx, event.address, "+odown event"); err != nil {
+				logger.Error("Failed to remove master label after odown event", logKeyError, err)
+			}
+		case "-odown":
+			reconciler.markMasterUp()
+		case "+sdown":
+			logger.Warn("Master is subjectively down")
+		}
+	}
 
-		time.Sleep(2 * time.Second)
+	reason := resyncReason(event, reconciler.group)
+	if reason == "" {
+		return
+	}
+	logger.Info("Resyncing after sentinel event", logKeyReason, reason)
+	reconciler.resync(ctx, reason)
+}
+
+// sleepWithContext waits for the given duration or until the context is cancelled.
+func sleepWithContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
 	}
 }
 
 func main() {
 	config, err := getConfig()
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	if err != nil {
-		log.Fatalf("Failed to get configuration: %v", err)
+		fatal("Failed to get configuration", logKeyError, err)
 	}
+	slog.SetDefault(newLogger(os.Stderr, config.LogLevel, config.LogFormat))
 
-	currentMaster, err := getCurrentMaster(ctx, config)
+	clientset, err := newKubernetesClient()
 	if err != nil {
-		log.Fatalf("Failed to get current master: %v", err)
+		fatal("Failed to create Kubernetes client", logKeyError, err)
+	}
+
+	if config.DryRun {
+		slog.Warn("Dry run: pod labels will not be changed")
+	}
+
+	broadcaster, recorder := newEventRecorder(config, clientset)
+	defer broadcaster.Shutdown()
+
+	startHTTPServer(ctx, config.HTTPListenAddr)
+
+	if len(config.WatchNamespaces) > 0 {
+		manager, err := newNamespaceManager(config, clientset, recorder)
+		if err != nil {
+			fatal("Failed to create namespace manager", logKeyError, err)
+		}
+		manager.start(ctx.Done())
+
+		if !config.LeaderElection {
+			manager.run(ctx)
+			return
+		}
+		runWithLeaderElection(ctx, config, clientset, manager.run)
+		return
 	}
 
-	log.Printf("Current master: %v", currentMaster)
+	// The pod caches are kept warm on standbys too, so a new leader can
+	// reconcile immediately.
+	var endpoints *masterEndpointsCache
+	if usesMasterService(config) {
+		var endpointsFactory informers.SharedInformerFactory
+		endpoints, endpointsFactory = newMasterEndpointsCache(clientset, config.Namespace)
+		endpointsFactory.Start(ctx.Done())
+	}
+	reconcilers := make(map[string]*Reconciler, len(config.Masters))
+	for _, group := range config.Masters {
+		reconciler, informerFactory, err := newReconciler(config, group, clientset, recorder)
+		if err != nil {
+			fatal("Failed to create reconciler", logKeyMasterName, group.Name, logKeyError, err)
+		}
+		reconciler.masterEndpoints = endpoints
+		informerFactory.Start(ctx.Done())
+		reconcilers[group.Name] = reconciler
+		health.expectMasters(reconciler.key())
+	}
 
-	setCurrentMaster(ctx, config, currentMaster)
+	run := func(ctx context.Context) {
+		health.setActive(true)
+		defer health.setActive(false)
+
+		for _, reconciler := range reconcilers {
+			if !reconciler.waitForCacheSync(ctx) {
+				slog.Warn("Pod cache did not sync before shutdown")
+				return
+			}
+		}
 
-	listenForSwitchMasterEvents(ctx, config, currentMaster)
+		// A failure here is not fatal: the event loop reconciles again as soon
+		// as it connects to sentinel.
+		resyncAll(ctx, reconcilers, "startup")
+
+		for _, reconciler := range reconcilers {
+			go reconciler.runResyncLoop(ctx)
+		}
+
+		listenForSwitchMasterEvents(ctx, config, reconcilers)
+	}
+
+	if !config.LeaderElection {
+		run(ctx)
+		return
+	}
 
+	runWithLeaderElection(ctx, config, clientset, run)
 }
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	corev1 "k8s.io/api/core/v1"
@@ -80,10 +83,17 @@ func TestGetConfig(t *testing.T) {
 				SentinelPort:        "26379",
 				SentinelHost:        "redis-sentinel",
 				SentinelPassword:    "password123",
+				SentinelTLS:         true,
 				MasterName:          "myprimary",
 				Namespace:           "default",
+				PodSelector:         defaultPodSelector,
 				MasterPodLabelName:  "valkey-master",
 				MasterPodLabelValue: "true",
+				LeaseName:           "valkey-reconciler",
+				LeaseDuration:       10 * time.Second,
+				RenewDeadline:       7 * time.Second,
+				RetryPeriod:         2 * time.Second,
+				ResyncInterval:      5 * time.Minute,
 			},
 		},
 		{
@@ -94,20 +104,127 @@ func TestGetConfig(t *testing.T) {
 				envValkeySentinelPassword: "custom-password",
 				envValkeyMasterName:       "custom-primary",
 				envPodNamespace:           "redis-namespace",
+				envValkeyPodSelector:      "app.kubernetes.io/instance in (vk)",
 				envMasterPodLabelName:     "custom-master",
 				envMasterPodLabelValue:    "yes",
+				envReplicaPodLabelValue:   "no",
 			},
 			expectError: false,
 			expected: &Config{
-				SentinelPort:        "26380",
-				SentinelHost:        "custom-sentinel",
-				SentinelPassword:    "custom-password",
-				MasterName:          "custom-primary",
-				Namespace:           "redis-namespace",
-				MasterPodLabelName:  "custom-master",
-				MasterPodLabelValue: "yes",
+				SentinelPort:         "26380",
+				SentinelHost:         "custom-sentinel",
+				SentinelPassword:     "custom-password",
+				SentinelTLS:          true,
+				MasterName:           "custom-primary",
+				Namespace:            "redis-namespace",
+				PodSelector:          "app.kubernetes.io/instance in (vk)",
+				MasterPodLabelName:   "custom-master",
+				MasterPodLabelValue:  "yes",
+				ReplicaPodLabelValue: "no",
+				LeaseName:            "valkey-reconciler",
+				LeaseDuration:        10 * time.Second,
+				RenewDeadline:        7 * time.Second,
+				RetryPeriod:          2 * time.Second,
+				ResyncInterval:       5 * time.Minute,
 			},
 		},
+		{
+			name: "leader election enabled with custom timings",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envLeaderElection:         "true",
+				envPodName:                "valkey-reconciler-abc",
+				envLeaseName:              "custom-lease",
+				envLeaseDuration:          "6s",
+				envRenewDeadline:          "4s",
+				envRetryPeriod:            "1s",
+			},
+			expectError: false,
+			expected: &Config{
+				SentinelPort:        "26379",
+				SentinelHost:        "redis-sentinel",
+				SentinelPassword:    "password123",
+				SentinelTLS:         true,
+				MasterName:          "myprimary",
+				Namespace:           "default",
+				PodSelector:         defaultPodSelector,
+				MasterPodLabelName:  "valkey-master",
+				MasterPodLabelValue: "true",
+				PodName:             "valkey-reconciler-abc",
+				LeaderElection:      true,
+				LeaseName:           "custom-lease",
+				LeaseDuration:       6 * time.Second,
+				RenewDeadline:       4 * time.Second,
+				RetryPeriod:         1 * time.Second,
+				ResyncInterval:      5 * time.Minute,
+			},
+		},
+		{
+			name: "resync disabled",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envResyncInterval:         "0s",
+			},
+			expectError: false,
+			expected: &Config{
+				SentinelPort:        "26379",
+				SentinelHost:        "redis-sentinel",
+				SentinelPassword:    "password123",
+				SentinelTLS:         true,
+				MasterName:          "myprimary",
+				Namespace:           "default",
+				PodSelector:         defaultPodSelector,
+				MasterPodLabelName:  "valkey-master",
+				MasterPodLabelValue: "true",
+				LeaseName:           "valkey-reconciler",
+				LeaseDuration:       10 * time.Second,
+				RenewDeadline:       7 * time.Second,
+				RetryPeriod:         2 * time.Second,
+				ResyncInterval:      0,
+			},
+		},
+		{
+			name: "replica label value equal to master label value",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envMasterPodLabelValue:    "master",
+				envReplicaPodLabelValue:   "master",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid pod selector",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envValkeyPodSelector:      "app.kubernetes.io/name==valkey=",
+			},
+			expectError: true,
+		},
+		{
+			name: "renew deadline not shorter than lease duration",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envLeaderElection:         "true",
+				envPodName:                "valkey-reconciler-abc",
+				envLeaseDuration:          "5s",
+				envRenewDeadline:          "5s",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid leader election flag",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envLeaderElection:         "maybe",
+			},
+			expectError: true,
+		},
 		{
 			name: "missing sentinel host",
 			envVars: map[string]string{
@@ -115,6 +232,177 @@ func TestGetConfig(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "watch namespaces without sentinel host",
+			envVars: map[string]string{
+				envValkeySentinelPassword: "password123",
+				envWatchNamespaces:        "team-a, team-b",
+			},
+			expectError: false,
+			expected: &Config{
+				SentinelPort:        "26379",
+				SentinelPassword:    "password123",
+				SentinelTLS:         true,
+				MasterName:          "myprimary",
+				Namespace:           "default",
+				WatchNamespaces:     []string{"team-a", "team-b"},
+				PodSelector:         defaultPodSelector,
+				MasterPodLabelName:  "valkey-master",
+				MasterPodLabelValue: "true",
+				LeaseName:           "valkey-reconciler",
+				LeaseDuration:       10 * time.Second,
+				RenewDeadline:       7 * time.Second,
+				RetryPeriod:         2 * time.Second,
+				ResyncInterval:      5 * time.Minute,
+			},
+		},
+		{
+			name: "sentinel addresses without sentinel host",
+			envVars: map[string]string{
+				envValkeySentinelPassword: "password123",
+				envValkeySentinelAddrs:    "10.244.0.2:26379, 10.244.0.3:26379",
+				envValkeySentinelDiscover: "true",
+				envValkeySentinelQuorum:   "2",
+			},
+			expectError: false,
+			expected: &Config{
+				SentinelPort:        "26379",
+				SentinelPassword:    "password123",
+				SentinelTLS:         true,
+				SentinelAddrs:       []string{"10.244.0.2:26379", "10.244.0.3:26379"},
+				SentinelDiscovery:   true,
+				SentinelQuorum:      2,
+				MasterName:          "myprimary",
+				Namespace:           "default",
+				PodSelector:         defaultPodSelector,
+				MasterPodLabelName:  "valkey-master",
+				MasterPodLabelValue: "true",
+				LeaseName:           "valkey-reconciler",
+				LeaseDuration:       10 * time.Second,
+				RenewDeadline:       7 * time.Second,
+				RetryPeriod:         2 * time.Second,
+				ResyncInterval:      5 * time.Minute,
+			},
+		},
+		{
+			name: "sentinel address without port",
+			envVars: map[string]string{
+				envValkeySentinelPassword: "password123",
+				envValkeySentinelAddrs:    "10.244.0.2",
+			},
+			expectError: true,
+		},
+		{
+			name: "TLS disabled",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envSentinelTLS:            "false",
+			},
+			expectError: false,
+			expected: &Config{
+				SentinelPort:        "26379",
+				SentinelHost:        "redis-sentinel",
+				SentinelPassword:    "password123",
+				MasterName:          "myprimary",
+				Namespace:           "default",
+				PodSelector:         defaultPodSelector,
+				MasterPodLabelName:  "valkey-master",
+				MasterPodLabelValue: "true",
+				LeaseName:           "valkey-reconciler",
+				LeaseDuration:       10 * time.Second,
+				RenewDeadline:       7 * time.Second,
+				RetryPeriod:         2 * time.Second,
+				ResyncInterval:      5 * time.Minute,
+			},
+		},
+		{
+			name: "ACL username",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envSentinelUsername:       "reconciler",
+			},
+			expectError: false,
+			expected: &Config{
+				SentinelPort:        "26379",
+				SentinelHost:        "redis-sentinel",
+				SentinelUsername:    "reconciler",
+				SentinelPassword:    "password123",
+				SentinelTLS:         true,
+				MasterName:          "myprimary",
+				Namespace:           "default",
+				PodSelector:         defaultPodSelector,
+				MasterPodLabelName:  "valkey-master",
+				MasterPodLabelValue: "true",
+				LeaseName:           "valkey-reconciler",
+				LeaseDuration:       10 * time.Second,
+				RenewDeadline:       7 * time.Second,
+				RetryPeriod:         2 * time.Second,
+				ResyncInterval:      5 * time.Minute,
+			},
+		},
+		{
+			name: "password and password file",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envSentinelPasswordFile:   "/etc/valkey/auth/password",
+			},
+			expectError: true,
+		},
+		{
+			name: "missing password file",
+			envVars: map[string]string{
+				envValkeySentinelHost:   "redis-sentinel",
+				envSentinelPasswordFile: "/nonexistent/password",
+			},
+			expectError: true,
+		},
+		{
+			name: "client certificate without key",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envSentinelTLSCertFile:    "/etc/valkey/tls/tls.crt",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid log level",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envLogLevel:               "verbose",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid log format",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envLogFormat:              "logfmt",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid sentinel quorum",
+			envVars: map[string]string{
+				envValkeySentinelHost:     "redis-sentinel",
+				envValkeySentinelPassword: "password123",
+				envValkeySentinelQuorum:   "-1",
+			},
+			expectError: true,
+		},
+		{
+			name: "all namespaces combined with a namespace",
+			envVars: map[string]string{
+				envValkeySentinelPassword: "password123",
+				envWatchNamespaces:        "*,team-a",
+			},
+			expectError: true,
+		},
 		{
 			name: "missing sentinel password",
 			envVars: map[string]string{
@@ -163,6 +451,9 @@ func TestGetConfig(t *testing.T) {
 			if config.SentinelHost != tt.expected.SentinelHost {
 				t.Errorf("SentinelHost = %v, want %v", config.SentinelHost, tt.expected.SentinelHost)
 			}
+			if config.SentinelUsername != tt.expected.SentinelUsername {
+				t.Errorf("SentinelUsername = %v, want %v", config.SentinelUsername, tt.expected.SentinelUsername)
+			}
 			if config.SentinelPassword != tt.expected.SentinelPassword {
 				t.Errorf("SentinelPassword = %v, want %v", config.SentinelPassword, tt.expected.SentinelPassword)
 			}
@@ -172,18 +463,336 @@ func TestGetConfig(t *testing.T) {
 			if config.Namespace != tt.expected.Namespace {
 				t.Errorf("Namespace = %v, want %v", config.Namespace, tt.expected.Namespace)
 			}
+			if !reflect.DeepEqual(config.SentinelAddrs, tt.expected.SentinelAddrs) {
+				t.Errorf("SentinelAddrs = %v, want %v", config.SentinelAddrs, tt.expected.SentinelAddrs)
+			}
+			if config.SentinelDiscovery != tt.expected.SentinelDiscovery {
+				t.Errorf("SentinelDiscovery = %v, want %v", config.SentinelDiscovery, tt.expected.SentinelDiscovery)
+			}
+			if config.SentinelTLS != tt.expected.SentinelTLS {
+				t.Errorf("SentinelTLS = %v, want %v", config.SentinelTLS, tt.expected.SentinelTLS)
+			}
+			if (config.SentinelTLSConfig != nil) != tt.expected.SentinelTLS {
+				t.Errorf("SentinelTLSConfig = %v, want TLS configured %v", config.SentinelTLSConfig, tt.expected.SentinelTLS)
+			}
+			if config.SentinelQuorum != tt.expected.SentinelQuorum {
+				t.Errorf("SentinelQuorum = %v, want %v", config.SentinelQuorum, tt.expected.SentinelQuorum)
+			}
+			if !reflect.DeepEqual(config.WatchNamespaces, tt.expected.WatchNamespaces) {
+				t.Errorf("WatchNamespaces = %v, want %v", config.WatchNamespaces, tt.expected.WatchNamespaces)
+			}
+			if config.PodSelector != tt.expected.PodSelector {
+				t.Errorf("PodSelector = %v, want %v", config.PodSelector, tt.expected.PodSelector)
+			}
 			if config.MasterPodLabelName != tt.expected.MasterPodLabelName {
 				t.Errorf("MasterPodLabelName = %v, want %v", config.MasterPodLabelName, tt.expected.MasterPodLabelName)
 			}
 			if config.MasterPodLabelValue != tt.expected.MasterPodLabelValue {
 				t.Errorf("MasterPodLabelValue = %v, want %v", config.MasterPodLabelValue, tt.expected.MasterPodLabelValue)
 			}
+			if config.ReplicaPodLabelValue != tt.expected.ReplicaPodLabelValue {
+				t.Errorf("ReplicaPodLabelValue = %v, want %v", config.ReplicaPodLabelValue, tt.expected.ReplicaPodLabelValue)
+			}
+			if config.LeaderElection != tt.expected.LeaderElection {
+				t.Errorf("LeaderElection = %v, want %v", config.LeaderElection, tt.expected.LeaderElection)
+			}
+			if tt.expected.PodName != "" && config.PodName != tt.expected.PodName {
+				t.Errorf("PodName = %v, want %v", config.PodName, tt.expected.PodName)
+			}
+			if config.LeaseName != tt.expected.LeaseName {
+				t.Errorf("LeaseName = %v, want %v", config.LeaseName, tt.expected.LeaseName)
+			}
+			if config.LeaseDuration != tt.expected.LeaseDuration {
+				t.Errorf("LeaseDuration = %v, want %v", config.LeaseDuration, tt.expected.LeaseDuration)
+			}
+			if config.RenewDeadline != tt.expected.RenewDeadline {
+				t.Errorf("RenewDeadline = %v, want %v", config.RenewDeadline, tt.expected.RenewDeadline)
+			}
+			if config.RetryPeriod != tt.expected.RetryPeriod {
+				t.Errorf("RetryPeriod = %v, want %v", config.RetryPeriod, tt.expected.RetryPeriod)
+			}
+			if config.ResyncInterval != tt.expected.ResyncInterval {
+				t.Errorf("ResyncInterval = %v, want %v", config.ResyncInterval, tt.expected.ResyncInterval)
+			}
+		})
+	}
+}
+
+func TestGetConfigNodeSettings(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "node-password")
+	if err := os.WriteFile(passwordFile, []byte("node-secret\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		envVars          map[string]string
+		expectedUsername string
+		expectedPassword string
+		expectedTLS      bool
+		expectedServer   string
+		expectError      bool
+	}{
+		{
+			name: "defaults to the sentinel settings",
+			envVars: map[string]string{
+				envSentinelUsername:   "sentinel-only",
+				envSentinelServerName: "vk-valkey",
+			},
+			expectedUsername: "sentinel-only",
+			expectedPassword: "password123",
+			expectedTLS:      true,
+			expectedServer:   "vk-valkey",
+		},
+		{
+			name: "separate node credentials and TLS",
+			envVars: map[string]string{
+				envSentinelUsername:   "sentinel-only",
+				envSentinelServerName: "vk-valkey",
+				envNodeUsername:       "reconciler",
+				envNodePassword:       "node-secret",
+				envNodeTLS:            "false",
+				envNodeServerName:     "vk-valkey-headless",
+			},
+			expectedUsername: "reconciler",
+			expectedPassword: "node-secret",
+			expectedTLS:      false,
+			expectedServer:   "vk-valkey-headless",
+		},
+		{
+			name: "node password file",
+			envVars: map[string]string{
+				envSentinelUsername: "sentinel-only",
+				envNodePasswordFile: passwordFile,
+			},
+			expectedPassword: "node-secret",
+			expectedTLS:      true,
+		},
+		{
+			name: "node password and password file",
+			envVars: map[string]string{
+				envNodePassword:     "node-secret",
+				envNodePasswordFile: passwordFile,
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envValkeySentinelHost, "redis-sentinel")
+			t.Setenv(envValkeySentinelPassword, "password123")
+			for key, value := range tt.envVars {
+				t.Setenv(key, value)
+			}
+
+			config, err := getConfig()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("getConfig() expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getConfig() unexpected error: %v", err)
+			}
+
+			username, password := config.NodeUsername, config.NodePassword
+			if config.NodeCredentials != nil {
+				username, password = config.NodeCredentials.credentials()
+			}
+			if username != tt.expectedUsername || password != tt.expectedPassword {
+				t.Errorf("node credentials = (%q, %q), want (%q, %q)", username, password, tt.expectedUsername, tt.expectedPassword)
+			}
+			if config.NodeTLS != tt.expectedTLS || (config.NodeTLSConfig != nil) != tt.expectedTLS {
+				t.Errorf("NodeTLS = %v (config %v), want %v", config.NodeTLS, config.NodeTLSConfig != nil, tt.expectedTLS)
+			}
+			if config.NodeServerName != tt.expectedServer {
+				t.Errorf("NodeServerName = %q, want %q", config.NodeServerName, tt.expectedServer)
+			}
+		})
+	}
+}
+
+func TestGetMasterGroups(t *testing.T) {
+	defaults := &Config{
+		MasterName:          "myprimary",
+		PodSelector:         defaultPodSelector,
+		MasterPodLabelName:  "valkey-master",
+		MasterPodLabelValue: "true",
+		HealthyReplicaValue: "true",
+	}
+
+	tests := []struct {
+		name        string
+		masters     string
+		expected    []MasterGroup
+		expectError bool
+	}{
+		{
+			name:    "single group from the global settings",
+			masters: "",
+			expected: []MasterGroup{
+				{Name: "myprimary", PodSelector: defaultPodSelector, MasterPodLabelName: "valkey-master", MasterPodLabelValue: "true", HealthyReplicaValue: "true"},
+			},
+		},
+		{
+			name:    "groups fall back to the global labels",
+			masters: `[{"name":"cache","podSelector":"app=cache"},{"name":"sessions","podSelector":"app=sessions","masterLabelName":"sessions-master"}]`,
+			expected: []MasterGroup{
+				{Name: "cache", PodSelector: "app=cache", MasterPodLabelName: "valkey-master", MasterPodLabelValue: "true", HealthyReplicaValue: "true"},
+				{Name: "sessions", PodSelector: "app=sessions", MasterPodLabelName: "sessions-master", MasterPodLabelValue: "true", HealthyReplicaValue: "true"},
+			},
+		},
+		{
+			name:        "invalid JSON",
+			masters:     `{"name":"cache"}`,
+			expectError: true,
+		},
+		{
+			name:        "empty list",
+			masters:     `[]`,
+			expectError: true,
+		},
+		{
+			name:        "missing name",
+			masters:     `[{"podSelector":"app=cache"}]`,
+			expectError: true,
+		},
+		{
+			name:        "duplicate name",
+			masters:     `[{"name":"cache"},{"name":"cache"}]`,
+			expectError: true,
+		},
+		{
+			name:        "invalid pod selector",
+			masters:     `[{"name":"cache","podSelector":"app in cache"}]`,
+			expectError: true,
+		},
+		{
+			name:        "replica value equal to master value",
+			masters:     `[{"name":"cache","replicaLabelValue":"true"}]`,
+			expectError: true,
+		},
+		{
+			name:    "master service per group",
+			masters: `[{"name":"cache","podSelector":"app=cache","masterServiceName":"cache-master"}]`,
+			expected: []MasterGroup{
+				{Name: "cache", PodSelector: "app=cache", MasterPodLabelName: "valkey-master", MasterPodLabelValue: "true", HealthyReplicaValue: "true", MasterServiceName: "cache-master"},
+			},
+		},
+		{
+			name:        "shared master service",
+			masters:     `[{"name":"cache","masterServiceName":"valkey-master"},{"name":"sessions","masterServiceName":"valkey-master"}]`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.masters != "" {
+				os.Setenv(envValkeyMasters, tt.masters)
+				defer os.Unsetenv(envValkeyMasters)
+			}
+
+			groups, err := getMasterGroups(defaults)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("getMasterGroups() expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getMasterGroups() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(groups, tt.expected) {
+				t.Errorf("getMasterGroups() = %+v, want %+v", groups, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetEnvBoolOrDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue bool
+		expected     bool
+		expectError  bool
+	}{
+		{name: "returns default when unset", envValue: "", defaultValue: true, expected: true},
+		{name: "parses true", envValue: "true", defaultValue: false, expected: true},
+		{name: "parses false", envValue: "0", defaultValue: true, expected: false},
+		{name: "rejects garbage", envValue: "yes please", defaultValue: false, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envValue != "" {
+				os.Setenv("TEST_BOOL_VAR", tt.envValue)
+				defer os.Unsetenv("TEST_BOOL_VAR")
+			}
+
+			result, err := getEnvBoolOrDefault("TEST_BOOL_VAR", tt.defaultValue)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("getEnvBoolOrDefault() expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getEnvBoolOrDefault() unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("getEnvBoolOrDefault() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetEnvDurationOrDefault(t *testing.T) {
+	tests := []struct {
+		name         string
+		envValue     string
+		defaultValue time.Duration
+		expected     time.Duration
+		expectError  bool
+	}{
+		{name: "returns default when unset", envValue: "", defaultValue: 5 * time.Second, expected: 5 * time.Second},
+		{name: "parses duration", envValue: "1m30s", defaultValue: time.Second, expected: 90 * time.Second},
+		{name: "rejects negative duration", envValue: "-1s", defaultValue: time.Second, expectError: true},
+		{name: "rejects bare number", envValue: "15", defaultValue: time.Second, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.envValue != "" {
+				os.Setenv("TEST_DURATION_VAR", tt.envValue)
+				defer os.Unsetenv("TEST_DURATION_VAR")
+			}
+
+			result, err := getEnvDurationOrDefault("TEST_DURATION_VAR", tt.defaultValue)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("getEnvDurationOrDefault() expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getEnvDurationOrDefault() unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("getEnvDurationOrDefault() = %v, want %v", result, tt.expected)
+			}
 		})
 	}
 }
 
 type mockSentinelClient struct {
 	masterAddr []string
+	replicas   []map[string]string
+	sentinels  []map[string]string
+	master     map[string]string
 	err        error
 }
 
@@ -197,6 +806,73 @@ func (m *mockSentinelClient) GetMasterAddrByName(ctx context.Context, name strin
 	return cmd
 }
 
+func (m *mockSentinelClient) Replicas(ctx context.Context, name string) *redis.MapStringStringSliceCmd {
+	cmd := redis.NewMapStringStringSliceCmd(ctx, "sentinel", "replicas", name)
+	if m.err != nil {
+		cmd.SetErr(m.err)
+	} else {
+		cmd.SetVal(m.replicas)
+	}
+	return cmd
+}
+
+func (m *mockSentinelClient) Sentinels(ctx context.Context, name string) *redis.MapStringStringSliceCmd {
+	cmd := redis.NewMapStringStringSliceCmd(ctx, "sentinel", "sentinels", name)
+	if m.err != nil {
+		cmd.SetErr(m.err)
+	} else {
+		cmd.SetVal(m.sentinels)
+	}
+	return cmd
+}
+
+func (m *mockSentinelClient) Master(ctx context.Context, name string) *redis.MapStringStringCmd {
+	cmd := redis.NewMapStringStringCmd(ctx, "sentinel", "master", name)
+	if m.err != nil {
+		cmd.SetErr(m.err)
+	} else {
+		cmd.SetVal(m.master)
+	}
+	return cmd
+}
+
+func TestGetDownMasterFromSentinel(t *testing.T) {
+	tests := []struct {
+		name        string
+		flags       string
+		expected    string
+		expectError bool
+	}{
+		{name: "master up", flags: "master", expected: ""},
+		{name: "subjectively down", flags: "s_down,master", expected: ""},
+		{name: "objectively down", flags: "s_down,o_down,master", expected: "10.244.1.5:6379"},
+		{name: "sentinel unreachable", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockSentinelClient{master: map[string]string{"ip": "10.244.1.5", "port": "6379", "flags": tt.flags}}
+			if tt.expectError {
+				mock.err = fmt.Errorf("connection refused")
+			}
+
+			down, err := getDownMasterFromSentinel(context.Background(), "myprimary", mock)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("getDownMasterFromSentinel() expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getDownMasterFromSentinel() unexpected error: %v", err)
+			}
+			if down != tt.expected {
+				t.Errorf("getDownMasterFromSentinel() = %q, want %q", down, tt.expected)
+			}
+		})
+	}
+}
+
 func TestGetCurrentMasterFromSentinel(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -222,17 +898,13 @@ func TestGetCurrentMasterFromSentinel(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			config := &Config{
-				MasterName: "test-master",
-			}
-
 			mockSentinel := &mockSentinelClient{
 				masterAddr: tt.mockAddr,
 				err:        tt.mockErr,
 			}
 
 			ctx := context.Background()
-			addr, err := getCurrentMasterFromSentinel(ctx, config, mockSentinel)
+			addr, err := getCurrentMasterFromSentinel(ctx, "test-master", mockSentinel)
 
 			if tt.expectedErrMsg != "" {
 				if err == nil {
@@ -262,6 +934,72 @@ func TestGetCurrentMasterFromSentinel(t *testing.T) {
 	}
 }
 
+func TestIsHealthyReplica(t *testing.T) {
+	tests := []struct {
+		name     string
+		replica  map[string]string
+		expected bool
+	}{
+		{
+			name:     "online in-sync replica",
+			replica:  map[string]string{"ip": "10.244.1.6", "flags": "slave", "master-link-status": "ok"},
+			expected: true,
+		},
+		{
+			name:     "subjectively down replica",
+			replica:  map[string]string{"ip": "10.244.1.6", "flags": "s_down,slave", "master-link-status": "ok"},
+			expected: false,
+		},
+		{
+			name:     "disconnected replica",
+			replica:  map[string]string{"ip": "10.244.1.6", "flags": "slave,disconnected", "master-link-status": "ok"},
+			expected: false,
+		},
+		{
+			name:     "replica with broken master link",
+			replica:  map[string]string{"ip": "10.244.1.6", "flags": "slave", "master-link-status": "err"},
+			expected: false,
+		},
+		{
+			name:     "entry without slave flag",
+			replica:  map[string]string{"ip": "10.244.1.6", "flags": "master", "master-link-status": "ok"},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isHealthyReplica(tt.replica); got != tt.expected {
+				t.Errorf("isHealthyReplica() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetHealthyReplicasFromSentinel(t *testing.T) {
+
+	mockSentinel := &mockSentinelClient{
+		replicas: []map[string]string{
+			{"ip": "10.244.1.6", "port": "6379", "flags": "slave", "master-link-status": "ok"},
+			{"ip": "10.244.1.7", "port": "6379", "flags": "s_down,slave,disconnected", "master-link-status": "err"},
+			{"ip": "10.244.1.8", "port": "6379", "flags": "slave", "master-link-status": "ok"},
+		},
+	}
+
+	healthy, err := getHealthyReplicasFromSentinel(context.Background(), "test-master", mockSentinel)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(healthy, ",") != "10.244.1.6:6379,10.244.1.8:6379" {
+		t.Errorf("healthy replicas = %v, want [10.244.1.6:6379 10.244.1.8:6379]", healthy)
+	}
+
+	mockSentinel.err = fmt.Errorf("sentinel connection failed")
+	if _, err := getHealthyReplicasFromSentinel(context.Background(), "test-master", mockSentinel); err == nil {
+		t.Errorf("expected error from failing sentinel, got nil")
+	}
+}
+
 func TestSetCurrentMaster(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -294,7 +1032,7 @@ func TestSetCurrentMaster(t *testing.T) {
 				},
 				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "valkey-1", 
+						Name:      "valkey-1",
 						Namespace: "default",
 						Labels: map[string]string{
 							"app.kubernetes.io/name": "valkey",
@@ -340,7 +1078,7 @@ func TestSetCurrentMaster(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create fake Kubernetes client
 			fakeClient := fake.NewSimpleClientset()
-			
+
 			// Add existing pods to the fake client
 			for _, pod := range tt.existingPods {
 				_, err := fakeClient.CoreV1().Pods(tt.config.Namespace).Create(
@@ -395,7 +1133,7 @@ func TestSetCurrentMaster(t *testing.T) {
 					actualUpdates++
 				} else if pod.Labels[tt.config.MasterPodLabelName] == tt.config.MasterPodLabelValue {
 					// This pod was the master but isn't anymore
-					pod.Labels[tt.config.MasterPodLabelName] = ""
+					delete(pod.Labels, tt.config.MasterPodLabelName)
 					_, err := fakeClient.CoreV1().Pods(tt.config.Namespace).Update(ctx, &pod, metav1.UpdateOptions{})
 					if err != nil {
 						t.Errorf("failed to update former master pod: %v", err)
@@ -441,7 +1179,7 @@ func TestSwitchMasterEventParsing(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			parts := strings.Fields(tt.payload)
-			
+
 			if len(parts) != tt.expectedParts {
 				t.Errorf("expected %d parts, got %d", tt.expectedParts, len(parts))
 				return
@@ -491,7 +1229,7 @@ func TestRebootEventHandling(t *testing.T) {
 			// This test validates the event channel matching logic
 			// In a real implementation, we'd need to mock the entire event processing
 			shouldQuery := tt.channel == "+reboot"
-			
+
 			if shouldQuery != tt.shouldQuery {
 				t.Errorf("expected shouldQuery=%v for channel %s, got %v", tt.shouldQuery, tt.channel, shouldQuery)
 			}
@@ -499,6 +1237,133 @@ func TestRebootEventHandling(t *testing.T) {
 	}
 }
 
+func TestEventMasterName(t *testing.T) {
+	tests := []struct {
+		name         string
+		payload      string
+		expectedName string
+		expectedOK   bool
+	}{
+		{
+			name:         "master instance",
+			payload:      "master myprimary 10.244.1.5 6379",
+			expectedName: "myprimary",
+			expectedOK:   true,
+		},
+		{
+			name:         "replica instance",
+			payload:      "slave 10.244.1.6:6379 10.244.1.6 6379 @ sessions 10.244.1.5 6379",
+			expectedName: "sessions",
+			expectedOK:   true,
+		},
+		{
+			name:       "no master name",
+			payload:    "slave 10.244.1.6:6379 10.244.1.6 6379",
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, ok := eventMasterName(tt.payload)
+			if ok != tt.expectedOK || name != tt.expectedName {
+				t.Errorf("eventMasterName() = %q, %v, want %q, %v", name, ok, tt.expectedName, tt.expectedOK)
+			}
+		})
+	}
+}
+
+func TestParseSentinelEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		channel    string
+		payload    string
+		expected   sentinelEvent
+		expectedOK bool
+	}{
+		{
+			name:    "master objectively down",
+			channel: "+odown",
+			payload: "master myprimary 10.244.1.5 6379 #quorum 2/2",
+			expected: sentinelEvent{
+				channel:      "+odown",
+				instanceType: "master",
+				masterName:   "myprimary",
+				address:      []string{"10.244.1.5", "6379"},
+			},
+			expectedOK: true,
+		},
+		{
+			name:    "replica role change",
+			channel: "+role-change",
+			payload: "slave 10.244.1.6:6379 10.244.1.6 6379 @ myprimary 10.244.1.5 6379 new reported role is master",
+			expected: sentinelEvent{
+				channel:      "+role-change",
+				instanceType: "slave",
+				masterName:   "myprimary",
+				address:      []string{"10.244.1.6", "6379"},
+			},
+			expectedOK: true,
+		},
+		{
+			name:       "no master name",
+			channel:    "+sdown",
+			payload:    "slave 10.244.1.6:6379 10.244.1.6 6379",
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := parseSentinelEvent(tt.channel, tt.payload)
+			if ok != tt.expectedOK {
+				t.Fatalf("parseSentinelEvent() ok = %v, want %v", ok, tt.expectedOK)
+			}
+			if !reflect.DeepEqual(event, tt.expected) {
+				t.Errorf("parseSentinelEvent() = %+v, want %+v", event, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResyncReason(t *testing.T) {
+	plain := MasterGroup{Name: "myprimary"}
+	withReplicas := MasterGroup{Name: "myprimary", HealthyReplicaLabel: "vk-replica"}
+
+	tests := []struct {
+		name         string
+		channel      string
+		instanceType string
+		group        MasterGroup
+		expectResync bool
+	}{
+		{name: "reboot", channel: "+reboot", instanceType: "master", group: plain, expectResync: true},
+		{name: "master objectively down", channel: "+odown", instanceType: "master", group: plain, expectResync: false},
+		{name: "master back up", channel: "-odown", instanceType: "master", group: plain, expectResync: true},
+		{name: "master subjectively down", channel: "+sdown", instanceType: "master", group: plain, expectResync: false},
+		{name: "master subjectively up", channel: "-sdown", instanceType: "master", group: plain, expectResync: true},
+		{name: "replica down without replica label", channel: "+sdown", instanceType: "slave", group: plain, expectResync: false},
+		{name: "replica down with replica label", channel: "+sdown", instanceType: "slave", group: withReplicas, expectResync: true},
+		{name: "replica up with replica label", channel: "-sdown", instanceType: "slave", group: withReplicas, expectResync: true},
+		{name: "sentinel down", channel: "+sdown", instanceType: "sentinel", group: withReplicas, expectResync: false},
+		{name: "failover end", channel: "+failover-end", instanceType: "master", group: plain, expectResync: true},
+		{name: "new replica without replica label", channel: "+slave", instanceType: "slave", group: plain, expectResync: false},
+		{name: "new replica with replica label", channel: "+slave", instanceType: "slave", group: withReplicas, expectResync: true},
+		{name: "convert to replica", channel: "+convert-to-slave", instanceType: "slave", group: plain, expectResync: true},
+		{name: "role change", channel: "+role-change", instanceType: "slave", group: plain, expectResync: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := sentinelEvent{channel: tt.channel, instanceType: tt.instanceType, masterName: "myprimary"}
+			reason := resyncReason(event, tt.group)
+			if (reason != "") != tt.expectResync {
+				t.Errorf("resyncReason() = %q, want resync %v", reason, tt.expectResync)
+			}
+		})
+	}
+}
+
 func TestIPParsing(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -530,7 +1395,7 @@ func TestIPParsing(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ip := net.ParseIP(tt.ip)
-			
+
 			if tt.expectNil && ip != nil {
 				t.Errorf("expected nil IP, got %v", ip)
 			}
@@ -604,7 +1469,7 @@ func TestPodLabelManagement(t *testing.T) {
 			if tt.shouldAddLabel {
 				labels[tt.labelName] = tt.labelValue
 			} else if tt.shouldRemoveLabel {
-				labels[tt.labelName] = ""
+				delete(labels, tt.labelName)
 			}
 
 			for key, expectedValue := range tt.expectedFinalLabels {
@@ -612,6 +1477,11 @@ func TestPodLabelManagement(t *testing.T) {
 					t.Errorf("expected label %s=%s, got %s", key, expectedValue, labels[key])
 				}
 			}
+			if tt.shouldRemoveLabel {
+				if _, ok := labels[tt.labelName]; ok {
+					t.Errorf("expected label %s to be removed", tt.labelName)
+				}
+			}
 		})
 	}
 }
@@ -619,7 +1489,7 @@ func TestPodLabelManagement(t *testing.T) {
 func BenchmarkGetEnvOrDefault(b *testing.B) {
 	os.Setenv("BENCH_TEST", "benchmark_value")
 	defer os.Unsetenv("BENCH_TEST")
-	
+
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		getEnvOrDefault("BENCH_TEST", "default")
@@ -628,7 +1498,7 @@ func BenchmarkGetEnvOrDefault(b *testing.B) {
 
 func BenchmarkSwitchMasterEventParsing(b *testing.B) {
 	payload := "myprimary 127.0.0.1 6379 192.168.1.10 6379"
-	
+
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		parts := strings.Fields(payload)
@@ -641,9 +1511,9 @@ func BenchmarkSwitchMasterEventParsing(b *testing.B) {
 
 func BenchmarkIPParsing(b *testing.B) {
 	ip := "192.168.1.10"
-	
+
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_ = net.ParseIP(ip)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "valkey_reconciler"
+
+var (
+	sentinelEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sentinel_events_total",
+		Help:      "Sentinel pub/sub events received, by channel.",
+	}, []string{"event"})
+
+	podLabelUpdatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pod_label_updates_total",
+		Help:      "Pod label updates attempted, by result.",
+	}, []string{"result"})
+
+	dryRunLabelChanges = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dry_run_label_changes",
+		Help:      "Label changes the last dry-run reconciliation would have made, by pod, label and change (add or remove).",
+	}, []string{"namespace", "master_name", "pod", "label", "change"})
+
+	masterRoleMismatchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "master_role_mismatches_total",
+		Help:      "Times the pod sentinel named as master did not report the master role, by namespace and master name.",
+	}, []string{"namespace", "master_name"})
+
+	masterLabelledPods = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "master_labelled_pods",
+		Help:      "Pods carrying the master label after the last reconciliation, by namespace and master name. More than one means the Service routes writes to several pods.",
+	}, []string{"namespace", "master_name"})
+
+	sentinelReconnectsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sentinel_reconnects_total",
+		Help:      "Times the event loop reconnected to sentinel after losing its connection.",
+	})
+
+	secondsSinceMasterChangeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "seconds_since_last_master_change"),
+		"Seconds since the reconciler last observed a different master address, or since it first observed one, by namespace and master name.",
+		[]string{"namespace", "master_name"}, nil,
+	)
+)
+
+func init() {
+	// Export zero-valued series so alerts can use rate() before the first event.
+	for _, event := range sentinelChannels {
+		sentinelEventsTotal.WithLabelValues(event)
+	}
+	for _, result := range []string{"success", "failure"} {
+		podLabelUpdatesTotal.WithLabelValues(result)
+	}
+	prometheus.MustRegister(masterChanges)
+}
+
+// masterChangeTracker remembers, per namespace and master name, the last master
+// address seen by setCurrentMaster and when it changed. It is a
+// prometheus.Collector so the gauge is computed at scrape time.
+type masterChangeTracker struct {
+	mu         sync.Mutex
+	masters    map[masterKey]*observedMaster
+	timeSource func() time.Time
+}
+
+type masterKey struct {
+	namespace string
+	name      string
+}
+
+type observedMaster struct {
+	address   string
+	changedAt time.Time
+}
+
+var masterChanges = newMasterChangeTracker(time.Now)
+
+func newMasterChangeTracker(timeSource func() time.Time) *masterChangeTracker {
+	return &masterChangeTracker{
+		masters:    make(map[masterKey]*observedMaster),
+		timeSource: timeSource,
+	}
+}
+
+func (t *masterChangeTracker) observe(namespace, masterName string, masterAddress []string) {
+	address := strings.Join(masterAddress, ":")
+	key := masterKey{namespace: namespace, name: masterName}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	master, ok := t.masters[key]
+	if !ok {
+		master = &observedMaster{}
+		t.masters[key] = master
+	}
+	if address != master.address {
+		master.address = address
+		master.changedAt = t.timeSource()
+	}
+}
+
+func (t *masterChangeTracker) secondsSinceChange(namespace, masterName string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	master, ok := t.masters[masterKey{namespace: namespace, name: masterName}]
+	if !ok {
+		return 0
+	}
+	return t.timeSource().Sub(master.changedAt).Seconds()
+}
+
+// forgetNamespace stops exporting the masters of a namespace that is no longer
+// served.
+func (t *masterChangeTracker) forgetNamespace(namespace string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.masters {
+		if key.namespace == namespace {
+			delete(t.masters, key)
+		}
+	}
+}
+
+func (t *masterChangeTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- secondsSinceMasterChangeDesc
+}
+
+func (t *masterChangeTracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	keys := make([]masterKey, 0, len(t.masters))
+	for key := range t.masters {
+		keys = append(keys, key)
+	}
+	t.mu.Unlock()
+
+	for _, key := range keys {
+		ch <- prometheus.MustNewConstMetric(secondsSinceMasterChangeDesc, prometheus.GaugeValue, t.secondsSinceChange(key.namespace, key.name), key.namespace, key.name)
+	}
+}
+
+// recordDryRunLabelChange exposes a label change that was skipped in dry-run
+// mode. A nil value means the label would have been removed.
+func recordDryRunLabelChange(namespace, masterName, pod, label string, value *string) {
+	change := "add"
+	if value == nil {
+		change = "remove"
+	}
+	dryRunLabelChanges.WithLabelValues(namespace, masterName, pod, label, change).Set(1)
+}
+
+// resetDryRunLabelChanges drops the dry-run changes recorded for namespace, or
+// only those of masterName in it when masterName is not empty.
+func resetDryRunLabelChanges(namespace, masterName string) {
+	match := prometheus.Labels{"namespace": namespace}
+	if masterName != "" {
+		match["master_name"] = masterName
+	}
+	dryRunLabelChanges.DeletePartialMatch(match)
+}
+
+// forgetNamespaceMetrics drops every per-namespace series of namespace once it
+// is no longer served.
+func forgetNamespaceMetrics(namespace string) {
+	masterChanges.forgetNamespace(namespace)
+	resetDryRunLabelChanges(namespace, "")
+	masterLabelledPods.DeletePartialMatch(prometheus.Labels{"namespace": namespace})
+}
+
+func recordPodLabelUpdate(err error) {
+	if err != nil {
+		podLabelUpdatesTotal.WithLabelValues("failure").Inc()
+		return
+	}
+	podLabelUpdatesTotal.WithLabelValues("success").Inc()
+}
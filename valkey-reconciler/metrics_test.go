@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMasterChangeTracker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tracker := newMasterChangeTracker(func() time.Time { return now })
+
+	if got := tracker.secondsSinceChange("default", "myprimary"); got != 0 {
+		t.Errorf("secondsSinceChange() before any observation = %v, want 0", got)
+	}
+
+	tracker.observe("default", "myprimary", []string{"10.0.0.1", "6379"})
+	now = now.Add(30 * time.Second)
+	if got := tracker.secondsSinceChange("default", "myprimary"); got != 30 {
+		t.Errorf("secondsSinceChange() = %v, want 30", got)
+	}
+
+	// Observing the same master again must not reset the timer.
+	tracker.observe("default", "myprimary", []string{"10.0.0.1", "6379"})
+	now = now.Add(10 * time.Second)
+	if got := tracker.secondsSinceChange("default", "myprimary"); got != 40 {
+		t.Errorf("secondsSinceChange() after same master = %v, want 40", got)
+	}
+
+	tracker.observe("default", "myprimary", []string{"10.0.0.2", "6379"})
+	now = now.Add(5 * time.Second)
+	if got := tracker.secondsSinceChange("default", "myprimary"); got != 5 {
+		t.Errorf("secondsSinceChange() after new master = %v, want 5", got)
+	}
+
+	// Masters are tracked independently of each other.
+	tracker.observe("default", "other", []string{"10.0.1.1", "6379"})
+	now = now.Add(5 * time.Second)
+	if got := tracker.secondsSinceChange("default", "other"); got != 5 {
+		t.Errorf("secondsSinceChange(other) = %v, want 5", got)
+	}
+	if got := tracker.secondsSinceChange("default", "myprimary"); got != 10 {
+		t.Errorf("secondsSinceChange(myprimary) after other master = %v, want 10", got)
+	}
+
+	tracker.observe("team-a", "myprimary", []string{"10.0.2.1", "6379"})
+	if got := testutil.CollectAndCount(tracker); got != 3 {
+		t.Errorf("collected %d series, want one per namespace and master (3)", got)
+	}
+
+	tracker.forgetNamespace("team-a")
+	if got := testutil.CollectAndCount(tracker); got != 2 {
+		t.Errorf("collected %d series after forgetting team-a, want 2", got)
+	}
+}
+
+func TestRecordPodLabelUpdate(t *testing.T) {
+	success := testutil.ToFloat64(podLabelUpdatesTotal.WithLabelValues("success"))
+	failure := testutil.ToFloat64(podLabelUpdatesTotal.WithLabelValues("failure"))
+
+	recordPodLabelUpdate(nil)
+	recordPodLabelUpdate(errors.New("conflict"))
+	recordPodLabelUpdate(nil)
+
+	if got := testutil.ToFloat64(podLabelUpdatesTotal.WithLabelValues("success")) - success; got != 2 {
+		t.Errorf("success updates = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(podLabelUpdatesTotal.WithLabelValues("failure")) - failure; got != 1 {
+		t.Errorf("failure updates = %v, want 1", got)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	masterChanges.observe("default", "myprimary", []string{"10.0.0.1", "6379"})
+
+	recorder := httptest.NewRecorder()
+	newHTTPHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if recorder.Code != 200 {
+		t.Fatalf("GET /metrics status = %d, want 200", recorder.Code)
+	}
+
+	body, _ := io.ReadAll(recorder.Body)
+	for _, name := range []string{
+		"valkey_reconciler_sentinel_events_total",
+		"valkey_reconciler_pod_label_updates_total",
+		"valkey_reconciler_sentinel_reconnects_total",
+		`valkey_reconciler_seconds_since_last_master_change{master_name="myprimary",namespace="default"}`,
+	} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics output missing %s", name)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// allNamespaces in WATCH_NAMESPACES serves every namespace in the cluster.
+const allNamespaces = "*"
+
+// sentinelAddressAnnotation on a Valkey pod tells the reconciler where the
+// sentinel for the pod's namespace listens, as host:port.
+const sentinelAddressAnnotation = "valkey-reconciler/sentinel-address"
+
+// namespaceManager serves the Valkey pods of several namespaces from one
+// process. It caches every master group's pods cluster-wide and, while active,
+// runs a set of reconcilers and a sentinel event loop for each watched
+// namespace that contains such pods.
+type namespaceManager struct {
+	config    *Config
+	clientset kubernetes.Interface
+	recorder  record.EventRecorder
+	watched   map[string]bool
+	watches   []*podWatch
+
+	// endpoints and endpointsFactory cache the master Services and
+	// EndpointSlices cluster-wide. They are nil unless a master group routes
+	// through a master Service.
+	endpoints        *masterEndpointsCache
+	endpointsFactory informers.SharedInformerFactory
+
+	// serve runs the reconcilers of one namespace until ctx is cancelled. It
+	// is a field so tests can replace the sentinel event loop.
+	serve func(ctx context.Context, config *Config, reconcilers map[string]*Reconciler)
+
+	mu      sync.Mutex
+	ctx     context.Context
+	workers map[string]*namespaceWorker
+}
+
+// podWatch is the cluster-wide pod cache of one master group.
+type podWatch struct {
+	group    MasterGroup
+	selector labels.Selector
+	factory  informers.SharedInformerFactory
+	pods     corelisters.PodLister
+	synced   cache.InformerSynced
+}
+
+// namespaceWorker is the set of reconcilers serving one namespace.
+type namespaceWorker struct {
+	groups      string
+	reconcilers map[string]*Reconciler
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func newNamespaceManager(config *Config, clientset kubernetes.Interface, recorder record.EventRecorder) (*namespaceManager, error) {
+	m := &namespaceManager{
+		config:    config,
+		clientset: clientset,
+		recorder:  recorder,
+		serve:     serveNamespace,
+		workers:   make(map[string]*namespaceWorker),
+	}
+	if !(len(config.WatchNamespaces) == 1 && config.WatchNamespaces[0] == allNamespaces) {
+		m.watched = make(map[string]bool, len(config.WatchNamespaces))
+		for _, namespace := range config.WatchNamespaces {
+			m.watched[namespace] = true
+		}
+	}
+	if usesMasterService(config) {
+		m.endpoints, m.endpointsFactory = newMasterEndpointsCache(clientset, "")
+	}
+
+	for _, group := range config.Masters {
+		selector, err := labels.Parse(group.PodSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod selector %q for master %s: %w", group.PodSelector, group.Name, err)
+		}
+
+		factory := newPodInformerFactory(clientset, "", selector)
+		podInformer := factory.Core().V1().Pods()
+		watch := &podWatch{
+			group:    group,
+			selector: selector,
+			factory:  factory,
+			pods:     podInformer.Lister(),
+			synced:   podInformer.Informer().HasSynced,
+		}
+		m.watches = append(m.watches, watch)
+
+		groupName := group.Name
+		podInformer.Informer().AddEventHandler(podEventHandler(func(pod *corev1.Pod) *Reconciler {
+			return m.reconcilerFor(pod.Namespace, groupName)
+		}))
+		podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					m.namespaceChanged(pod.Namespace)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if pod, ok := obj.(*corev1.Pod); ok {
+					m.namespaceChanged(pod.Namespace)
+				}
+			},
+		})
+	}
+
+	return m, nil
+}
+
+// start starts the pod informers. The caches are kept warm on standbys too,
+// so a new leader can reconcile immediately.
+func (m *namespaceManager) start(stopCh <-chan struct{}) {
+	for _, watch := range m.watches {
+		watch.factory.Start(stopCh)
+	}
+	if m.endpointsFactory != nil {
+		m.endpointsFactory.Start(stopCh)
+	}
+}
+
+// run serves every watched namespace that contains Valkey pods until ctx is
+// cancelled, starting and stopping namespaces as their pods come and go.
+func (m *namespaceManager) run(ctx context.Context) {
+	health.setActive(true)
+	defer health.setActive(false)
+
+	for _, watch := range m.watches {
+		if !cache.WaitForCacheSync(ctx.Done(), watch.synced) {
+			slog.Warn("Pod cache did not sync before shutdown")
+			return
+		}
+	}
+	if m.endpoints != nil && !cache.WaitForCacheSync(ctx.Done(), m.endpoints.synced...) {
+		slog.Warn("Master endpoints cache did not sync before shutdown")
+		return
+	}
+
+	m.mu.Lock()
+	m.ctx = ctx
+	for _, namespace := range m.namespaces() {
+		m.syncWorkerLocked(namespace)
+	}
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	m.ctx = nil
+	for namespace := range m.workers {
+		m.stopWorkerLocked(namespace)
+	}
+	m.mu.Unlock()
+}
+
+// namespaceChanged starts, restarts or stops the worker of namespace after one
+// of its Valkey pods was added or deleted.
+func (m *namespaceManager) namespaceChanged(namespace string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx == nil {
+		return
+	}
+	m.syncWorkerLocked(namespace)
+}
+
+func (m *namespaceManager) syncWorkerLocked(namespace string) {
+	if m.watched != nil && !m.watched[namespace] {
+		return
+	}
+
+	watches := m.watchesIn(namespace)
+	groups := groupNames(watches)
+	if worker, ok := m.workers[namespace]; ok {
+		if worker.groups == groups {
+			return
+		}
+		m.stopWorkerLocked(namespace)
+	}
+	if len(watches) == 0 {
+		return
+	}
+
+	var pods []*corev1.Pod
+	for _, watch := range watches {
+		namespacePods, _ := watch.pods.Pods(namespace).List(watch.selector)
+		pods = append(pods, namespacePods...)
+	}
+	host, port, err := discoverSentinel(m.config, namespace, pods)
+	if err != nil {
+		slog.Warn("Not serving namespace", logKeyNamespace, namespace, logKeyError, err)
+		return
+	}
+
+	config := *m.config
+	config.Namespace = namespace
+	config.SentinelHost = host
+	config.SentinelPort = port
+	config.SentinelAddrs = nil
+
+	reconcilers := make(map[string]*Reconciler, len(watches))
+	for _, watch := range watches {
+		r := newReconcilerWithCache(&config, watch.group, watch.selector, m.clientset, m.recorder, watch.pods, watch.synced)
+		r.masterEndpoints = m.endpoints
+		reconcilers[watch.group.Name] = r
+		health.expectMasters(r.key())
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	worker := &namespaceWorker{
+		groups:      groups,
+		reconcilers: reconcilers,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	m.workers[namespace] = worker
+
+	slog.Info("Serving namespace", logKeyNamespace, namespace, "masters", groups, logKeySentinel, net.JoinHostPort(host, port))
+	go func() {
+		defer close(worker.done)
+		m.serve(ctx, &config, reconcilers)
+	}()
+}
+
+// stopWorkerLocked stops the worker of namespace and waits for it to exit, so
+// that it cannot report health for a namespace that is no longer served.
+func (m *namespaceManager) stopWorkerLocked(namespace string) {
+	worker := m.workers[namespace]
+	worker.cancel()
+	<-worker.done
+	delete(m.workers, namespace)
+	health.forgetNamespace(namespace)
+	forgetNamespaceMetrics(namespace)
+	slog.Info("Stopped serving namespace", logKeyNamespace, namespace)
+}
+
+// reconcilerFor returns the Reconciler for group in namespace, or nil when the
+// namespace is not being served.
+func (m *namespaceManager) reconcilerFor(namespace, group string) *Reconciler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if worker, ok := m.workers[namespace]; ok {
+		return worker.reconcilers[group]
+	}
+	return nil
+}
+
+// namespaces returns every namespace that contains pods of any master group.
+func (m *namespaceManager) namespaces() []string {
+	seen := make(map[string]bool)
+	for _, watch := range m.watches {
+		pods, _ := watch.pods.List(watch.selector)
+		for _, pod := range pods {
+			seen[pod.Namespace] = true
+		}
+	}
+
+	namespaces := make([]string, 0, len(seen))
+	for namespace := range seen {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// watchesIn returns the master groups that have pods in namespace.
+func (m *namespaceManager) watchesIn(namespace string) []*podWatch {
+	var watches []*podWatch
+	for _, watch := range m.watches {
+		pods, _ := watch.pods.Pods(namespace).List(watch.selector)
+		if len(pods) > 0 {
+			watches = append(watches, watch)
+		}
+	}
+	return watches
+}
+
+func groupNames(watches []*podWatch) string {
+	names := make([]string, 0, len(watches))
+	for _, watch := range watches {
+		names = append(names, watch.group.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// serveNamespace reconciles a namespace on startup and then follows its
+// sentinel until ctx is cancelled.
+func serveNamespace(ctx context.Context, config *Config, reconcilers map[string]*Reconciler) {
+	resyncAll(ctx, reconcilers, "startup")
+
+	var wg sync.WaitGroup
+	for _, reconciler := range reconcilers {
+		wg.Add(1)
+		go func(r *Reconciler) {
+			defer wg.Done()
+			r.runResyncLoop(ctx)
+		}(reconciler)
+	}
+
+	listenForSwitchMasterEvents(ctx, config, reconcilers)
+	wg.Wait()
+}
+
+// discoverSentinel returns the sentinel address for namespace. The
+// sentinelAddressAnnotation on any of the namespace's Valkey pods wins;
+// otherwise VALKEY_SENTINEL_HOST is resolved as a Service in the namespace.
+// The reconciler sends the shared sentinel password to the address, so an
+// annotation may only name a Service in the pod's own namespace or a host in
+// VALKEY_SENTINEL_ALLOWED_HOSTS.
+func discoverSentinel(config *Config, namespace string, pods []*corev1.Pod) (string, string, error) {
+	sorted := append([]*corev1.Pod(nil), pods...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	for _, pod := range sorted {
+		address, ok := pod.Annotations[sentinelAddressAnnotation]
+		if !ok {
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid %s annotation on pod %s: %v", sentinelAddressAnnotation, pod.Name, err)
+		}
+		allowed, ok := allowedSentinelHost(config, namespace, host)
+		if !ok {
+			return "", "", fmt.Errorf("%s annotation on pod %s names %s, which is neither a Service in namespace %s nor listed in %s",
+				sentinelAddressAnnotation, pod.Name, host, namespace, envSentinelAllowedHosts)
+		}
+		return allowed, port, nil
+	}
+
+	if config.SentinelHost == "" {
+		return "", "", fmt.Errorf("no pod has the %s annotation and %s is not set", sentinelAddressAnnotation, envValkeySentinelHost)
+	}
+
+	host := config.SentinelHost
+	if !strings.Contains(host, ".") {
+		host = fmt.Sprintf("%s.%s.svc", host, namespace)
+	}
+	return host, config.SentinelPort, nil
+}
+
+// allowedSentinelHost checks a host taken from sentinelAddressAnnotation. A
+// Service name in namespace, written as "<service>", "<service>.<namespace>"
+// or "<service>.<namespace>.svc", is returned qualified; any other host must
+// be listed in VALKEY_SENTINEL_ALLOWED_HOSTS.
+func allowedSentinelHost(config *Config, namespace, host string) (string, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, allowed := range config.SentinelAllowedHosts {
+		if host == allowed {
+			return host, true
+		}
+	}
+	if net.ParseIP(host) != nil {
+		return "", false
+	}
+
+	parts := strings.Split(host, ".")
+	switch {
+	case parts[0] == "":
+		return "", false
+	case len(parts) == 1,
+		len(parts) == 2 && parts[1] == namespace,
+		len(parts) == 3 && parts[1] == namespace && parts[2] == "svc":
+		return fmt.Sprintf("%s.%s.svc", parts[0], namespace), true
+	}
+	return "", false
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDiscoverSentinel(t *testing.T) {
+	annotated := newValkeyPod("valkey-1", "10.244.1.6", nil)
+	annotated.Annotations = map[string]string{sentinelAddressAnnotation: "sentinel.team-a.svc:26380"}
+
+	invalid := newValkeyPod("valkey-1", "10.244.1.6", nil)
+	invalid.Annotations = map[string]string{sentinelAddressAnnotation: "sentinel"}
+
+	annotatedWith := func(address string) *corev1.Pod {
+		pod := newValkeyPod("valkey-1", "10.244.1.6", nil)
+		pod.Annotations = map[string]string{sentinelAddressAnnotation: address}
+		return pod
+	}
+
+	tests := []struct {
+		name         string
+		sentinelHost string
+		allowedHosts []string
+		pods         []*corev1.Pod
+		expectedHost string
+		expectedPort string
+		expectError  bool
+	}{
+		{
+			name:         "annotation wins over the service",
+			sentinelHost: "vk-valkey",
+			pods:         []*corev1.Pod{newValkeyPod("valkey-0", "10.244.1.5", nil), annotated},
+			expectedHost: "sentinel.team-a.svc",
+			expectedPort: "26380",
+		},
+		{
+			name:         "short service name is resolved in the namespace",
+			sentinelHost: "vk-valkey",
+			pods:         []*corev1.Pod{newValkeyPod("valkey-0", "10.244.1.5", nil)},
+			expectedHost: "vk-valkey.team-a.svc",
+			expectedPort: "26379",
+		},
+		{
+			name:         "qualified host is used as is",
+			sentinelHost: "sentinel.shared.svc.cluster.local",
+			pods:         []*corev1.Pod{newValkeyPod("valkey-0", "10.244.1.5", nil)},
+			expectedHost: "sentinel.shared.svc.cluster.local",
+			expectedPort: "26379",
+		},
+		{
+			name:         "annotated short service name is qualified",
+			pods:         []*corev1.Pod{annotatedWith("sentinel:26380")},
+			expectedHost: "sentinel.team-a.svc",
+			expectedPort: "26380",
+		},
+		{
+			name:        "annotation naming another namespace",
+			pods:        []*corev1.Pod{annotatedWith("sentinel.team-b.svc:26379")},
+			expectError: true,
+		},
+		{
+			name:        "annotation naming an external host",
+			pods:        []*corev1.Pod{annotatedWith("sentinel.team-a.svc.example.com:26379")},
+			expectError: true,
+		},
+		{
+			name:        "annotation naming an IP",
+			pods:        []*corev1.Pod{annotatedWith("192.0.2.10:26379")},
+			expectError: true,
+		},
+		{
+			name:         "allowed external host",
+			allowedHosts: []string{"sentinel.shared.svc.cluster.local"},
+			pods:         []*corev1.Pod{annotatedWith("sentinel.shared.svc.cluster.local:26379")},
+			expectedHost: "sentinel.shared.svc.cluster.local",
+			expectedPort: "26379",
+		},
+		{
+			name:        "annotation without port",
+			pods:        []*corev1.Pod{invalid},
+			expectError: true,
+		},
+		{
+			name:        "no annotation and no host",
+			pods:        []*corev1.Pod{newValkeyPod("valkey-0", "10.244.1.5", nil)},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{SentinelHost: tt.sentinelHost, SentinelPort: "26379", SentinelAllowedHosts: tt.allowedHosts}
+
+			host, port, err := discoverSentinel(config, "team-a", tt.pods)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("discoverSentinel() expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("discoverSentinel() unexpected error: %v", err)
+			}
+			if host != tt.expectedHost || port != tt.expectedPort {
+				t.Errorf("discoverSentinel() = %s:%s, want %s:%s", host, port, tt.expectedHost, tt.expectedPort)
+			}
+		})
+	}
+}
+
+func TestNamespaceManagerServesWatchedNamespaces(t *testing.T) {
+	config := &Config{
+		Namespace:       "platform",
+		SentinelHost:    "vk-valkey",
+		SentinelPort:    "26379",
+		WatchNamespaces: []string{"team-a", "team-c"},
+		Masters: []MasterGroup{
+			{Name: "myprimary", PodSelector: defaultPodSelector, MasterPodLabelName: "vk-master", MasterPodLabelValue: "true"},
+		},
+	}
+
+	podIn := func(namespace, name string) *corev1.Pod {
+		pod := newValkeyPod(name, "10.244.1.5", nil)
+		pod.Namespace = namespace
+		return pod
+	}
+
+	client := fake.NewSimpleClientset(podIn("team-a", "valkey-0"), podIn("team-b", "valkey-0"))
+	m, err := newNamespaceManager(config, client, record.NewFakeRecorder(100))
+	if err != nil {
+		t.Fatalf("newNamespaceManager() error = %v", err)
+	}
+
+	type served struct {
+		namespace string
+		sentinel  string
+	}
+	started := make(chan served, 4)
+	stopped := make(chan string, 4)
+	m.serve = func(ctx context.Context, config *Config, reconcilers map[string]*Reconciler) {
+		if _, ok := reconcilers["myprimary"]; !ok {
+			t.Errorf("namespace %s is served without a reconciler for myprimary", config.Namespace)
+		}
+		started <- served{config.Namespace, config.SentinelHost}
+		<-ctx.Done()
+		stopped <- config.Namespace
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.start(ctx.Done())
+	go m.run(ctx)
+
+	expectStarted := func(namespace string) {
+		t.Helper()
+		select {
+		case got := <-started:
+			if got.namespace != namespace || got.sentinel != "vk-valkey."+namespace+".svc" {
+				t.Errorf("served %+v, want namespace %s", got, namespace)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("namespace %s was not served", namespace)
+		}
+	}
+
+	expectStarted("team-a")
+
+	if _, err := client.CoreV1().Pods("team-c").Create(ctx, podIn("team-c", "valkey-0"), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create pod: %v", err)
+	}
+	expectStarted("team-c")
+
+	if err := client.CoreV1().Pods("team-a").Delete(ctx, "valkey-0", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete pod: %v", err)
+	}
+	select {
+	case namespace := <-stopped:
+		if namespace != "team-a" {
+			t.Errorf("stopped serving %s, want team-a", namespace)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("team-a was still served after its last pod was deleted")
+	}
+
+	select {
+	case got := <-started:
+		t.Errorf("unexpected namespace served: %+v", got)
+	default:
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// valkeyPortAnnotation on a Valkey pod names the port its Valkey instance
+// listens on. It is needed when several instances share the node's network and
+// the pod spec does not declare the port as a container port.
+const valkeyPortAnnotation = "valkey-reconciler/valkey-port"
+
+// addressMatcher decides which pod an address reported by sentinel refers to.
+// Sentinel reports IP addresses by default, but with resolve-hostnames and
+// announce-hostnames it reports the pod's DNS name, which may resolve to
+// several addresses on dual-stack clusters.
+type addressMatcher struct {
+	address string
+	port    string
+	ips     []net.IP
+
+	// lookupErr is the DNS error for a hostname that did not resolve. The
+	// hostname may still match a pod directly.
+	lookupErr error
+}
+
+// newAddressMatcher returns a matcher for address, resolving it when it is not
+// already an IP address. port may be empty when sentinel does not report it.
+func newAddressMatcher(address, port string) *addressMatcher {
+	m := &addressMatcher{address: strings.TrimSuffix(strings.ToLower(address), "."), port: port}
+	if ip := net.ParseIP(address); ip != nil {
+		m.ips = []net.IP{ip}
+		return m
+	}
+	m.ips, m.lookupErr = net.LookupIP(address)
+	return m
+}
+
+// matches reports whether pod serves the address, either through one of its
+// IPs or through its hostname under the headless Service.
+func (m *addressMatcher) matches(pod *corev1.Pod) bool {
+	for _, podIP := range podIPs(pod) {
+		for _, ip := range m.ips {
+			if podIP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return matchesPodHostname(m.address, pod)
+}
+
+// matchPods returns the names of the pods that serve the address. When the
+// address alone matches several pods, as when they share the node's network,
+// only the pods serving the port are kept. If none does, all of them are
+// returned, so callers treat the address as ambiguous rather than unmatched.
+func (m *addressMatcher) matchPods(pods []*corev1.Pod) map[string]bool {
+	var matched []*corev1.Pod
+	for _, pod := range pods {
+		if m.matches(pod) {
+			matched = append(matched, pod)
+		}
+	}
+	if len(matched) > 1 && m.port != "" {
+		var onPort []*corev1.Pod
+		for _, pod := range matched {
+			if servesPort(pod, m.port) {
+				onPort = append(onPort, pod)
+			}
+		}
+		if len(onPort) > 0 {
+			matched = onPort
+		}
+	}
+
+	names := make(map[string]bool, len(matched))
+	for _, pod := range matched {
+		names[pod.Name] = true
+	}
+	return names
+}
+
+// noMatchError explains why no pod matched the address.
+func (m *addressMatcher) noMatchError() error {
+	address := m.address
+	if m.port != "" {
+		address = net.JoinHostPort(m.address, m.port)
+	}
+	if m.lookupErr != nil {
+		return fmt.Errorf("no pod found matching master address %s: %w", address, m.lookupErr)
+	}
+	return fmt.Errorf("no pod found matching master address %s (%v)", address, m.ips)
+}
+
+// podIPs returns every IP of pod, covering both families on dual-stack
+// clusters.
+func podIPs(pod *corev1.Pod) []net.IP {
+	var ips []net.IP
+	for _, podIP := range pod.Status.PodIPs {
+		if ip := net.ParseIP(podIP.IP); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		if ip := net.ParseIP(pod.Status.PodIP); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// servesPort reports whether pod listens on port: the port in
+// valkeyPortAnnotation when the pod has it, otherwise any container or host
+// port in its spec. Pods that declare no port are assumed to serve any port.
+func servesPort(pod *corev1.Pod, port string) bool {
+	if annotated, ok := pod.Annotations[valkeyPortAnnotation]; ok {
+		return strings.TrimSpace(annotated) == port
+	}
+
+	declared := false
+	for _, container := range pod.Spec.Containers {
+		for _, containerPort := range container.Ports {
+			declared = true
+			if strconv.Itoa(int(containerPort.ContainerPort)) == port ||
+				(containerPort.HostPort != 0 && strconv.Itoa(int(containerPort.HostPort)) == port) {
+				return true
+			}
+		}
+	}
+	return !declared
+}
+
+// matchesPodHostname reports whether host is one of the DNS names of pod:
+// "<hostname>.<subdomain>" optionally followed by the namespace, "svc" and the
+// cluster domain. Pods without a subdomain only match their hostname.
+func matchesPodHostname(host string, pod *corev1.Pod) bool {
+	hostname := pod.Spec.Hostname
+	if hostname == "" {
+		hostname = pod.Name
+	}
+	hostname = strings.ToLower(hostname)
+	if host == hostname {
+		return true
+	}
+	if pod.Spec.Subdomain == "" {
+		return false
+	}
+
+	name := hostname + "." + strings.ToLower(pod.Spec.Subdomain)
+	for _, suffix := range []string{"", "." + pod.Namespace, "." + pod.Namespace + ".svc"} {
+		if host == name+suffix {
+			return true
+		}
+	}
+	return strings.HasPrefix(host, name+"."+pod.Namespace+".svc.")
+}
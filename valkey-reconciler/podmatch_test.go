@@ -0,0 +1,247 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newHeadlessPod(name, subdomain string, ips ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       corev1.PodSpec{Hostname: name, Subdomain: subdomain},
+	}
+	for _, ip := range ips {
+		pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: ip})
+	}
+	if len(ips) > 0 {
+		pod.Status.PodIP = ips[0]
+	}
+	return pod
+}
+
+func TestNewAddressMatcherSkipsDNSForIPs(t *testing.T) {
+	for _, address := range []string{"10.244.1.5", "fd00::5"} {
+		m := newAddressMatcher(address, "")
+		if m.lookupErr != nil {
+			t.Errorf("newAddressMatcher(%q) lookup error: %v", address, m.lookupErr)
+		}
+		if len(m.ips) != 1 || !m.ips[0].Equal(net.ParseIP(address)) {
+			t.Errorf("newAddressMatcher(%q) ips = %v, want [%s]", address, m.ips, address)
+		}
+	}
+}
+
+func TestAddressMatcherMatches(t *testing.T) {
+	dualStack := newHeadlessPod("valkey-0", "vk-valkey-headless", "10.244.1.5", "fd00::5")
+	legacy := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "valkey-1", Namespace: "default"},
+		Status:     corev1.PodStatus{PodIP: "10.244.1.6"},
+	}
+
+	tests := []struct {
+		name    string
+		matcher *addressMatcher
+		pod     *corev1.Pod
+		want    bool
+	}{
+		{
+			name:    "IPv4 address",
+			matcher: newAddressMatcher("10.244.1.5", ""),
+			pod:     dualStack,
+			want:    true,
+		},
+		{
+			name:    "IPv6 address of a dual-stack pod",
+			matcher: newAddressMatcher("fd00::5", ""),
+			pod:     dualStack,
+			want:    true,
+		},
+		{
+			name:    "any resolved address",
+			matcher: &addressMatcher{address: "valkey.example", ips: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::5")}},
+			pod:     dualStack,
+			want:    true,
+		},
+		{
+			name:    "PodIP without PodIPs",
+			matcher: newAddressMatcher("10.244.1.6", ""),
+			pod:     legacy,
+			want:    true,
+		},
+		{
+			name:    "headless hostname",
+			matcher: &addressMatcher{address: "valkey-0.vk-valkey-headless.default.svc.cluster.local"},
+			pod:     dualStack,
+			want:    true,
+		},
+		{
+			name:    "different IP",
+			matcher: newAddressMatcher("10.244.1.7", ""),
+			pod:     dualStack,
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.matcher.matches(tt.pod); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesPodHostname(t *testing.T) {
+	pod := newHeadlessPod("valkey-0", "vk-valkey-headless")
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"valkey-0", true},
+		{"valkey-0.vk-valkey-headless", true},
+		{"valkey-0.vk-valkey-headless.default", true},
+		{"valkey-0.vk-valkey-headless.default.svc", true},
+		{"valkey-0.vk-valkey-headless.default.svc.cluster.local", true},
+		{"valkey-1.vk-valkey-headless.default.svc.cluster.local", false},
+		{"valkey-0.vk-valkey-headless.other.svc.cluster.local", false},
+		{"valkey-0.other-headless.default.svc.cluster.local", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := matchesPodHostname(tt.host, pod); got != tt.want {
+				t.Errorf("matchesPodHostname(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+
+	standalone := newHeadlessPod("valkey-0", "")
+	if matchesPodHostname("valkey-0.vk-valkey-headless", standalone) {
+		t.Error("matchesPodHostname() matched a subdomain on a pod without one")
+	}
+}
+
+func TestNewAddressMatcherNormalizesHostname(t *testing.T) {
+	m := newAddressMatcher("Valkey-0.VK-Valkey-Headless.default.svc.cluster.local.", "")
+	if !m.matches(newHeadlessPod("valkey-0", "vk-valkey-headless")) {
+		t.Errorf("matches() = false for %q, want true", m.address)
+	}
+}
+
+func newHostNetworkPod(name, ip string, containerPort int32, annotations map[string]string) *corev1.Pod {
+	pod := newHeadlessPod(name, "", ip)
+	pod.Annotations = annotations
+	pod.Spec.HostNetwork = true
+	if containerPort != 0 {
+		pod.Spec.Containers = []corev1.Container{{
+			Name:  "valkey",
+			Ports: []corev1.ContainerPort{{Name: "valkey", ContainerPort: containerPort, HostPort: containerPort}},
+		}}
+	}
+	return pod
+}
+
+func TestServesPort(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		port string
+		want bool
+	}{
+		{
+			name: "container port",
+			pod:  newHostNetworkPod("valkey-0", "10.0.0.1", 6379, nil),
+			port: "6379",
+			want: true,
+		},
+		{
+			name: "other container port",
+			pod:  newHostNetworkPod("valkey-0", "10.0.0.1", 6380, nil),
+			port: "6379",
+			want: false,
+		},
+		{
+			name: "annotation wins over the container port",
+			pod:  newHostNetworkPod("valkey-0", "10.0.0.1", 6379, map[string]string{valkeyPortAnnotation: "6380"}),
+			port: "6380",
+			want: true,
+		},
+		{
+			name: "annotation names another port",
+			pod:  newHostNetworkPod("valkey-0", "10.0.0.1", 6379, map[string]string{valkeyPortAnnotation: "6380"}),
+			port: "6379",
+			want: false,
+		},
+		{
+			name: "no declared port",
+			pod:  newHostNetworkPod("valkey-0", "10.0.0.1", 0, nil),
+			port: "6379",
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := servesPort(tt.pod, tt.port); got != tt.want {
+				t.Errorf("servesPort(%q) = %v, want %v", tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressMatcherMatchPods(t *testing.T) {
+	pods := []*corev1.Pod{
+		newHostNetworkPod("valkey-a", "10.0.0.1", 6379, nil),
+		newHostNetworkPod("valkey-b", "10.0.0.1", 6380, nil),
+		newHostNetworkPod("valkey-c", "10.0.0.2", 6380, nil),
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		port    string
+		want    []string
+	}{
+		{
+			name:    "port picks between pods sharing an address",
+			address: "10.0.0.1",
+			port:    "6380",
+			want:    []string{"valkey-b"},
+		},
+		{
+			name:    "unique address ignores the port",
+			address: "10.0.0.2",
+			port:    "30380",
+			want:    []string{"valkey-c"},
+		},
+		{
+			name:    "no pod on the port",
+			address: "10.0.0.1",
+			port:    "6390",
+			want:    []string{"valkey-a", "valkey-b"},
+		},
+		{
+			name:    "no port",
+			address: "10.0.0.1",
+			want:    []string{"valkey-a", "valkey-b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newAddressMatcher(tt.address, tt.port).matchPods(pods)
+			if len(got) != len(tt.want) {
+				t.Fatalf("matchPods() = %v, want %v", got, tt.want)
+			}
+			for _, name := range tt.want {
+				if !got[name] {
+					t.Errorf("matchPods() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
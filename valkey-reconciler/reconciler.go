@@ -0,0 +1,668 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+)
+
+// reconcileBackoff bounds how long a single reconciliation is retried before
+// giving up and waiting for the next sentinel event.
+var reconcileBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    6,
+	Cap:      10 * time.Second,
+}
+
+// Reconciler keeps the master label on the pods of one master group in line
+// with the master reported by sentinel.
+type Reconciler struct {
+	config     *Config
+	group      MasterGroup
+	selector   labels.Selector
+	clientset  kubernetes.Interface
+	pods       corelisters.PodLister
+	podsSynced cache.InformerSynced
+	recorder   record.EventRecorder
+
+	// masterEndpoints caches the master Services and EndpointSlices. It is
+	// nil unless a master group routes through a master Service.
+	masterEndpoints *masterEndpointsCache
+
+	// mu serialises reconciliations triggered by sentinel events, pod churn
+	// and the periodic resync.
+	mu sync.Mutex
+
+	// downMaster is the address of a master sentinel reported as objectively
+	// down. While sentinel still names it as the master, setCurrentMaster
+	// keeps the master label off its pod. Guarded by mu.
+	downMaster string
+
+	// healthyReplicas looks up the replicas sentinel considers healthy. It
+	// is a field so tests can replace the sentinel query.
+	healthyReplicas func(ctx context.Context, masterName string) ([]string, error)
+
+	// downMasterAddr returns the address of the master when sentinel
+	// currently flags it as objectively down. It is a field so tests can
+	// replace the sentinel query.
+	downMasterAddr func(ctx context.Context, masterName string) (string, error)
+
+	// nodeRole asks the Valkey node at addr for its replication role. It is
+	// a field so tests can replace the node query.
+	nodeRole func(ctx context.Context, addr string) (string, error)
+
+	// podEvents carries pod churn notifications from the informer to
+	// runResyncLoop. It has a buffer of one so bursts collapse into a single
+	// reconciliation.
+	podEvents chan string
+}
+
+// newReconciler creates a Reconciler for group backed by a shared informer on
+// the pods matching the group's selector in config.Namespace. The informer is
+// started by the caller through the returned factory.
+func newReconciler(config *Config, group MasterGroup, clientset kubernetes.Interface, recorder record.EventRecorder) (*Reconciler, informers.SharedInformerFactory, error) {
+	selector, err := labels.Parse(group.PodSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pod selector %q for master %s: %w", group.PodSelector, group.Name, err)
+	}
+
+	factory := newPodInformerFactory(clientset, config.Namespace, selector)
+	podInformer := factory.Core().V1().Pods().Informer()
+
+	r := newReconcilerWithCache(config, group, selector, clientset, recorder, factory.Core().V1().Pods().Lister(), podInformer.HasSynced)
+	podInformer.AddEventHandler(podEventHandler(func(pod *corev1.Pod) *Reconciler { return r }))
+
+	return r, factory, nil
+}
+
+// newReconcilerWithCache creates a Reconciler that reads pods from an existing
+// cache, such as a cluster-wide informer shared between namespaces.
+func newReconcilerWithCache(config *Config, group MasterGroup, selector labels.Selector, clientset kubernetes.Interface, recorder record.EventRecorder, pods corelisters.PodLister, podsSynced cache.InformerSynced) *Reconciler {
+	return &Reconciler{
+		config:     config,
+		group:      group,
+		selector:   selector,
+		clientset:  clientset,
+		pods:       pods,
+		podsSynced: podsSynced,
+		recorder:   recorder,
+		healthyReplicas: func(ctx context.Context, masterName string) ([]string, error) {
+			return getHealthyReplicas(ctx, config, masterName)
+		},
+		downMasterAddr: func(ctx context.Context, masterName string) (string, error) {
+			return getDownMaster(ctx, config, masterName)
+		},
+		nodeRole: func(ctx context.Context, addr string) (string, error) {
+			return getNodeRole(ctx, config, addr)
+		},
+		podEvents: make(chan string, 1),
+	}
+}
+
+// newPodInformerFactory returns an informer factory for the pods matching
+// selector in namespace, or in every namespace when namespace is empty.
+func newPodInformerFactory(clientset kubernetes.Interface, namespace string, selector labels.Selector) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector.String()
+		}),
+	)
+}
+
+// podEventHandler forwards relevant pod churn to the Reconciler returned by
+// route, which may return nil for pods no Reconciler is responsible for.
+func podEventHandler(route func(pod *corev1.Pod) *Reconciler) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				if r := route(pod); r != nil {
+					r.notifyPodEvent(fmt.Sprintf("pod %s added", pod.Name))
+				}
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, ok := oldObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			newPod, ok := newObj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+			r := route(newPod)
+			if r == nil {
+				return
+			}
+			if reason := r.podChangeReason(oldPod, newPod); reason != "" {
+				r.notifyPodEvent(reason)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				if r := route(pod); r != nil {
+					r.notifyPodEvent(fmt.Sprintf("pod %s deleted", pod.Name))
+				}
+			}
+		},
+	}
+}
+
+// key identifies the Reconciler's master group across namespaces.
+func (r *Reconciler) key() string {
+	return r.config.Namespace + "/" + r.group.Name
+}
+
+// logger returns the default logger annotated with the Reconciler's namespace
+// and master name.
+func (r *Reconciler) logger() *slog.Logger {
+	return slog.With(logKeyNamespace, r.config.Namespace, logKeyMasterName, r.group.Name)
+}
+
+// podChangeReason reports why an updated pod needs a reconciliation, or an
+// empty string when the update does not affect master labelling.
+func (r *Reconciler) podChangeReason(oldPod, newPod *corev1.Pod) string {
+	if oldPod.Status.PodIP != newPod.Status.PodIP {
+		return fmt.Sprintf("pod %s IP changed from %q to %q", newPod.Name, oldPod.Status.PodIP, newPod.Status.PodIP)
+	}
+	for _, name := range []string{r.group.MasterPodLabelName, r.group.HealthyReplicaLabel} {
+		if name == "" {
+			continue
+		}
+		oldValue, oldOk := oldPod.Labels[name]
+		newValue, newOk := newPod.Labels[name]
+		if oldValue != newValue || oldOk != newOk {
+			return fmt.Sprintf("pod %s label %s changed", newPod.Name, name)
+		}
+	}
+	return ""
+}
+
+// notifyPodEvent queues a reconciliation without blocking the informer. If one
+// is already pending the notification is dropped.
+func (r *Reconciler) notifyPodEvent(reason string) {
+	select {
+	case r.podEvents <- reason:
+	default:
+	}
+}
+
+// waitForCacheSync blocks until the pod cache, and the master endpoints cache
+// if there is one, has been populated.
+func (r *Reconciler) waitForCacheSync(ctx context.Context) bool {
+	synced := []cache.InformerSynced{r.podsSynced}
+	if r.masterEndpoints != nil {
+		synced = append(synced, r.masterEndpoints.synced...)
+	}
+	return cache.WaitForCacheSync(ctx.Done(), synced...)
+}
+
+// reconcileWithRetry calls setCurrentMaster until it succeeds, the backoff is
+// exhausted or ctx is cancelled. It returns the number of pods whose labels
+// were changed and the last error. reason describes what triggered the
+// reconciliation and ends up in the Events recorded on relabelled pods.
+func (r *Reconciler) reconcileWithRetry(ctx context.Context, masterAddress []string, reason string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := 0
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, reconcileBackoff, func(ctx context.Context) (bool, error) {
+		var n int
+		n, lastErr = r.setCurrentMaster(ctx, masterAddress, reason)
+		changed += n
+		if lastErr != nil {
+			r.logger().Warn("Failed to set current master, retrying", logKeyMasterAddr, masterAddr(masterAddress), logKeyError, lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if lastErr == nil {
+		lastErr = err
+	}
+
+	health.recordReconcile(r.key(), lastErr)
+	return changed, lastErr
+}
+
+// setCurrentMaster labels the pod whose IP matches masterAddress as master and
+// removes the label from any other pod. When HealthyReplicaLabel is set it also
+// labels the replicas sentinel reports as healthy. It returns the number of
+// pods whose labels were changed.
+//
+// Nothing is labelled when the address matches more than one pod. Every
+// demotion is applied before the promotion, and the master is not labelled
+// while the previous master could not be demoted. If more than one
+// pod still ends up carrying the master label an error is returned and the
+// masterLabelledPods gauge shows the count.
+//
+// Promotions and demotions are recorded as MasterPromoted and MasterDemoted
+// Events on the pod, mentioning reason.
+func (r *Reconciler) setCurrentMaster(ctx context.Context, masterAddress []string, reason string) (int, error) {
+	group := r.group
+
+	if len(masterAddress) < 2 {
+		return 0, fmt.Errorf("invalid master address: %v", masterAddress)
+	}
+
+	logger := r.logger().With(logKeyMasterAddr, masterAddr(masterAddress), logKeyReason, reason)
+	logger.Debug("Setting current master")
+	masterChanges.observe(r.config.Namespace, group.Name, masterAddress)
+
+	// A sentinel flagging the master o_down marks it down even if the +odown
+	// event was missed. An answer without the flag clears nothing, as the
+	// sentinels asked may not have reached o_down yet: only -odown,
+	// +switch-master or a reconnect to sentinel end the state.
+	if r.config.DropMasterOnODown {
+		down, err := r.downMasterAddr(ctx, group.Name)
+		if err != nil {
+			logger.Warn("Failed to check whether the master is objectively down", logKeyError, err)
+		} else if down != "" {
+			r.downMaster = down
+		}
+	}
+
+	// Once sentinel names another master the failover is over.
+	if r.downMaster != "" && r.downMaster != masterAddr(masterAddress) {
+		r.downMaster = ""
+	}
+	masterDown := r.downMaster != ""
+
+	pods, err := r.pods.Pods(r.config.Namespace).List(r.selector)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pods: %w", err)
+	}
+	if r.config.DryRun {
+		resetDryRunLabelChanges(r.config.Namespace, group.Name)
+	}
+
+	logger.Debug("Listed pods", "count", len(pods), "selector", r.selector.String())
+
+	master := newAddressMatcher(masterAddress[0], masterAddress[1])
+	isMasterPod := master.matchPods(pods)
+	masterFound := len(isMasterPod) > 0
+	// Without a resolvable address nothing is known about the master, so
+	// leave every label alone rather than demote it.
+	if !masterFound && master.lookupErr != nil {
+		return 0, master.noMatchError()
+	}
+	// Promoting several pods would route writes to more than one of them, so
+	// an ambiguous address changes nothing.
+	if len(isMasterPod) > 1 {
+		names := make([]string, 0, len(isMasterPod))
+		for name := range isMasterPod {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("master address %s matches %d pods, not labelling any: %s", masterAddr(masterAddress), len(names), strings.Join(names, ", "))
+	}
+
+	// A pod that is not labelled yet has its role checked once, before it
+	// receives either the endpoint or the label. Sentinel may be stale or
+	// split, so a failed check changes nothing and the current master keeps
+	// its label and endpoint.
+	var masterPod *corev1.Pod
+	for _, pod := range pods {
+		if isMasterPod[pod.Name] && !masterDown {
+			masterPod = pod
+		}
+	}
+	if masterPod != nil && r.config.VerifyMasterRole && masterPod.Labels[group.MasterPodLabelName] != group.MasterPodLabelValue {
+		if err := r.verifyMasterRole(ctx, masterPod, masterAddress[1]); err != nil {
+			logger.Error("Not routing to pod as master", logKeyPod, masterPod.Name, logKeyError, err)
+			return 0, err
+		}
+	}
+
+	var errs []error
+	changed := 0
+
+	// The EndpointSlice moves to the new master in a single write, so it is
+	// updated before any label rather than waiting for the demotions.
+	if group.MasterServiceName != "" {
+		updated, err := r.setMasterEndpoints(ctx, masterPod, masterAddress)
+		if err != nil {
+			logger.Error("Failed to update master endpoints", logKeyError, err)
+			errs = append(errs, err)
+		} else if updated {
+			changed++
+		}
+	}
+
+	// Demote before promoting, so the Service never selects two pods. labelled
+	// tracks which pods carry the master label as the updates are applied.
+	demotionFailed := false
+	labelled := make(map[string]bool)
+	var candidates []*corev1.Pod
+	for _, pod := range pods {
+		wasMaster := pod.Labels[group.MasterPodLabelName] == group.MasterPodLabelValue
+		if wasMaster {
+			labelled[pod.Name] = true
+		}
+
+		isMaster := isMasterPod[pod.Name]
+		if isMaster && !masterDown {
+			candidates = append(candidates, pod)
+			continue
+		}
+		if !r.needsDemotion(pod) {
+			logger.Debug("Pod is not the master", logKeyPod, pod.Name)
+			continue
+		}
+
+		switch {
+		case isMaster:
+			logger.Warn("Master is objectively down, removing master label", logKeyPod, pod.Name)
+		case wasMaster:
+			logger.Info("Pod was the master, demoting", logKeyPod, pod.Name)
+		default:
+			logger.Info("Pod is not the master, correcting label", logKeyPod, pod.Name)
+		}
+		err := r.patchPodLabel(ctx, pod, group.MasterPodLabelName, r.replicaLabelValue())
+		if err != nil {
+			logger.Error("Failed to remove label from pod", logKeyPod, pod.Name, logKeyError, err)
+			errs = append(errs, fmt.Errorf("failed to remove label from pod %s: %w", pod.Name, err))
+			demotionFailed = demotionFailed || wasMaster
+			continue
+		}
+		delete(labelled, pod.Name)
+		switch {
+		case isMaster:
+			r.recordEvent(pod, corev1.EventTypeNormal, eventReasonMasterDemoted, "Demoted from master of %s while it is objectively down (%s)", group.Name, reason)
+		case wasMaster:
+			r.recordEvent(pod, corev1.EventTypeNormal, eventReasonMasterDemoted, "Demoted from master of %s, new master is %s:%s (%s)", group.Name, masterAddress[0], masterAddress[1], reason)
+		}
+		changed++
+	}
+
+	for _, pod := range candidates {
+		logger.Debug("Pod is the master", logKeyPod, pod.Name)
+		if labelled[pod.Name] {
+			continue
+		}
+		if demotionFailed {
+			errs = append(errs, fmt.Errorf("not labelling pod %s as master while the previous master keeps its label", pod.Name))
+			continue
+		}
+		logger.Info("Pod is the master, promoting", logKeyPod, pod.Name)
+		err := r.patchPodLabel(ctx, pod, group.MasterPodLabelName, &group.MasterPodLabelValue)
+		if err != nil {
+			logger.Error("Failed to label pod as master", logKeyPod, pod.Name, logKeyError, err)
+			errs = append(errs, fmt.Errorf("failed to label pod %s as master: %w", pod.Name, err))
+			continue
+		}
+		labelled[pod.Name] = true
+		r.recordEvent(pod, corev1.EventTypeNormal, eventReasonMasterPromoted, "Promoted to master of %s at %s:%s (%s)", group.Name, masterAddress[0], masterAddress[1], reason)
+		changed++
+	}
+
+	if !masterFound {
+		errs = append(errs, master.noMatchError())
+	}
+
+	masterLabelledPods.WithLabelValues(r.config.Namespace, group.Name).Set(float64(len(labelled)))
+	if len(labelled) > 1 {
+		names := make([]string, 0, len(labelled))
+		for name := range labelled {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		logger.Error("More than one pod carries the master label", "pods", names)
+		errs = append(errs, fmt.Errorf("%d pods carry the master label %s=%s: %s", len(names), group.MasterPodLabelName, group.MasterPodLabelValue, strings.Join(names, ", ")))
+	}
+
+	if group.HealthyReplicaLabel != "" {
+		n, err := r.setHealthyReplicas(ctx, pods, isMasterPod)
+		changed += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return changed, errors.Join(errs...)
+}
+
+// markMasterDown records that sentinel considers the master at address
+// objectively down and removes the master label from its pod, so clients fail
+// fast instead of connecting to a dead master until the failover completes.
+func (r *Reconciler) markMasterDown(ctx context.Context, address []string, reason string) (int, error) {
+	r.mu.Lock()
+	r.downMaster = masterAddr(address)
+	r.mu.Unlock()
+	return r.reconcileWithRetry(ctx, address, reason)
+}
+
+// markMasterUp forgets a master reported down by markMasterDown, so the next
+// reconciliation labels it again.
+func (r *Reconciler) markMasterUp() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.downMaster = ""
+}
+
+// setHealthyReplicas applies HealthyReplicaLabel to the pods sentinel reports
+// as online, in-sync replicas and removes it from every other pod, including
+// the master.
+func (r *Reconciler) setHealthyReplicas(ctx context.Context, pods []*corev1.Pod, isMasterPod map[string]bool) (int, error) {
+	group := r.group
+
+	addresses, err := r.healthyReplicas(ctx, group.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	// Replicas are matched by address and port like the master, so an
+	// unhealthy instance sharing a healthy one's address stays unlabelled.
+	isHealthy := make(map[string]bool)
+	for _, address := range addresses {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			host, port = address, ""
+		}
+		replica := newAddressMatcher(host, port)
+		if replica.lookupErr != nil {
+			r.logger().Debug("Failed to lookup replica address, matching by hostname only", "replica_addr", address, logKeyError, replica.lookupErr)
+		}
+		matched := replica.matchPods(pods)
+		if len(matched) > 1 {
+			r.logger().Debug("Replica address matches several pods, labelling none", "replica_addr", address, "count", len(matched))
+			continue
+		}
+		for name := range matched {
+			isHealthy[name] = true
+		}
+	}
+
+	var errs []error
+	changed := 0
+	for _, pod := range pods {
+		healthy := isHealthy[pod.Name] && !isMasterPod[pod.Name]
+
+		current, ok := pod.Labels[group.HealthyReplicaLabel]
+		var value *string
+		if healthy {
+			if ok && current == group.HealthyReplicaValue {
+				continue
+			}
+			r.logger().Info("Pod is a healthy replica", logKeyPod, pod.Name)
+			value = &group.HealthyReplicaValue
+		} else {
+			if !ok {
+				continue
+			}
+			r.logger().Info("Pod is no longer a healthy replica", logKeyPod, pod.Name)
+		}
+
+		err := r.patchPodLabel(ctx, pod, group.HealthyReplicaLabel, value)
+		if err != nil {
+			r.logger().Error("Failed to update replica label on pod", logKeyPod, pod.Name, logKeyError, err)
+			errs = append(errs, fmt.Errorf("failed to update replica label on pod %s: %w", pod.Name, err))
+			continue
+		}
+		changed++
+	}
+
+	return changed, errors.Join(errs...)
+}
+
+// replicaLabelValue returns the value non-master pods should carry under
+// MasterPodLabelName, or nil when the label should be absent.
+func (r *Reconciler) replicaLabelValue() *string {
+	if r.group.ReplicaPodLabelValue == "" {
+		return nil
+	}
+	return &r.group.ReplicaPodLabelValue
+}
+
+// needsDemotion reports whether a pod that is not the master carries a master
+// label that differs from the configured replica state. This also cleans up
+// empty "label=" values left behind by older versions.
+func (r *Reconciler) needsDemotion(pod *corev1.Pod) bool {
+	current, ok := pod.Labels[r.group.MasterPodLabelName]
+	if replica := r.replicaLabelValue(); replica != nil {
+		return current != *replica
+	}
+	return ok
+}
+
+// patchPodLabel sets a single label on pod to value with a JSON merge patch
+// that touches nothing but that one label, so it cannot clobber concurrent
+// writes to other fields of the pod. A nil value removes the label. In dry-run
+// mode the change is only logged and recorded in dryRunLabelChanges.
+func (r *Reconciler) patchPodLabel(ctx context.Context, pod *corev1.Pod, name string, value *string) error {
+	if r.config.DryRun {
+		if value == nil {
+			r.logger().Info("Dry run: would remove label", logKeyPod, pod.Name, "label", name, "current", pod.Labels[name])
+		} else {
+			r.logger().Info("Dry run: would set label", logKeyPod, pod.Name, "label", name, "value", *value, "current", pod.Labels[name])
+		}
+		recordDryRunLabelChange(r.config.Namespace, r.group.Name, pod.Name, name, value)
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]*string{
+				name: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The patch carries no resourceVersion, so it never conflicts. Throttling
+	// and server timeouts are retried here; anything else is left to
+	// reconcileWithRetry.
+	err = retry.OnError(retry.DefaultBackoff, isRetryablePatchError, func() error {
+		_, err := r.clientset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+	recordPodLabelUpdate(err)
+	return err
+}
+
+// isRetryablePatchError reports whether a failed patch is worth repeating
+// straight away.
+func isRetryablePatchError(err error) bool {
+	return apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err)
+}
+
+// recordEvent records an Event on pod. Nothing is recorded in dry-run mode,
+// where the pod's labels were left alone.
+func (r *Reconciler) recordEvent(pod *corev1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.config.DryRun {
+		return
+	}
+	r.recorder.Eventf(pod, eventType, reason, messageFmt, args...)
+}
+
+// verifyMasterRole connects to the Valkey node on pod and returns an error
+// unless it reports the master role. A mismatch means sentinel's view is stale
+// or split, so it is counted and recorded as a Warning Event on the pod.
+func (r *Reconciler) verifyMasterRole(ctx context.Context, pod *corev1.Pod, port string) error {
+	addr := net.JoinHostPort(pod.Status.PodIP, port)
+	role, err := r.nodeRole(ctx, addr)
+	if err != nil {
+		return fmt.Errorf("failed to verify role of pod %s at %s: %w", pod.Name, addr, err)
+	}
+	if role == "master" {
+		return nil
+	}
+
+	masterRoleMismatchesTotal.WithLabelValues(r.config.Namespace, r.group.Name).Inc()
+	r.recordEvent(pod, corev1.EventTypeWarning, eventReasonMasterRoleMismatch, "Sentinel reports this pod as master of %s, but it reports role %s", r.group.Name, role)
+	return fmt.Errorf("pod %s at %s reports role %s, not master", pod.Name, addr, role)
+}
+
+// runResyncLoop re-reads the master from sentinel and corrects any label drift
+// every ResyncInterval and whenever the pod informer reports relevant churn.
+// This covers events lost while reconnecting, manual label edits and pods
+// recreated with a new IP.
+func (r *Reconciler) runResyncLoop(ctx context.Context) {
+	var tick <-chan time.Time
+	if r.config.ResyncInterval > 0 {
+		ticker := time.NewTicker(r.config.ResyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var reason string
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			reason = "periodic resync"
+		case reason = <-r.podEvents:
+		}
+
+		r.resync(ctx, reason)
+	}
+}
+
+// resync queries sentinel for the group's current master and reconciles the
+// pod labels against it, logging when labels had to be corrected.
+func (r *Reconciler) resync(ctx context.Context, reason string) {
+	currentMaster, err := getCurrentMaster(ctx, r.config, r.group.Name)
+	if err != nil {
+		r.logger().Error("Resync failed to get current master", logKeyReason, reason, logKeyError, err)
+		return
+	}
+
+	changed, err := r.reconcileWithRetry(ctx, currentMaster, reason)
+	if err != nil {
+		r.logger().Error("Resync failed", logKeyReason, reason, logKeyMasterAddr, masterAddr(currentMaster), logKeyError, err)
+		return
+	}
+	if changed > 0 && r.config.DryRun {
+		r.logger().Info("Resync would correct labels", logKeyReason, reason, logKeyMasterAddr, masterAddr(currentMaster), "pods", changed)
+	} else if changed > 0 {
+		r.logger().Info("Resync corrected labels", logKeyReason, reason, logKeyMasterAddr, masterAddr(currentMaster), "pods", changed)
+	}
+}
@@ -0,0 +1,1265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+func newValkeyPod(name, ip string, labels map[string]string) *corev1.Pod {
+	podLabels := map[string]string{
+		"app.kubernetes.io/name":     "valkey",
+		"app.kubernetes.io/instance": "vk",
+	}
+	for k, v := range labels {
+		podLabels[k] = v
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    podLabels,
+		},
+		Status: corev1.PodStatus{
+			PodIP: ip,
+		},
+	}
+}
+
+// testReconciler wires a Reconciler to a fake clientset and hand-fed pod and
+// master endpoints caches, so tests control exactly what the informers would
+// have seen.
+type testReconciler struct {
+	*Reconciler
+	client   *fake.Clientset
+	indexer  cache.Indexer
+	services cache.Indexer
+	slices   cache.Indexer
+	recorder *record.FakeRecorder
+}
+
+func newTestReconciler(t *testing.T, config *Config, pods ...*corev1.Pod) *testReconciler {
+	t.Helper()
+
+	objects := make([]runtime.Object, 0, len(pods))
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pod := range pods {
+		objects = append(objects, pod)
+		if err := indexer.Add(pod); err != nil {
+			t.Fatalf("failed to add pod to cache: %v", err)
+		}
+	}
+
+	// Tests describe the labels in Config, as a single-master deployment
+	// would, and the reconciler manages them as its only group.
+	group := MasterGroup{
+		Name:                 stringOrDefault(config.MasterName, "myprimary"),
+		PodSelector:          stringOrDefault(config.PodSelector, defaultPodSelector),
+		MasterPodLabelName:   config.MasterPodLabelName,
+		MasterPodLabelValue:  config.MasterPodLabelValue,
+		ReplicaPodLabelValue: config.ReplicaPodLabelValue,
+		HealthyReplicaLabel:  config.HealthyReplicaLabel,
+		HealthyReplicaValue:  config.HealthyReplicaValue,
+	}
+	selector, err := labels.Parse(group.PodSelector)
+	if err != nil {
+		t.Fatalf("invalid pod selector: %v", err)
+	}
+
+	client := fake.NewSimpleClientset(objects...)
+	recorder := record.NewFakeRecorder(100)
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	slices := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return &testReconciler{
+		Reconciler: &Reconciler{
+			config:     config,
+			group:      group,
+			selector:   selector,
+			clientset:  client,
+			pods:       corelisters.NewPodLister(indexer),
+			podsSynced: func() bool { return true },
+			recorder:   recorder,
+			masterEndpoints: &masterEndpointsCache{
+				services: corelisters.NewServiceLister(services),
+				slices:   discoverylisters.NewEndpointSliceLister(slices),
+			},
+			healthyReplicas: func(ctx context.Context, masterName string) ([]string, error) {
+				return nil, nil
+			},
+			downMasterAddr: func(ctx context.Context, masterName string) (string, error) {
+				return "", nil
+			},
+			nodeRole: func(ctx context.Context, addr string) (string, error) {
+				return "master", nil
+			},
+			podEvents: make(chan string, 1),
+		},
+		client:   client,
+		indexer:  indexer,
+		services: services,
+		slices:   slices,
+		recorder: recorder,
+	}
+}
+
+// syncCache copies the current state of the fake API server into the pod and
+// master endpoints caches, as the informers would after observing our writes.
+func (tr *testReconciler) syncCache(t *testing.T) {
+	t.Helper()
+
+	pods, err := tr.client.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list pods: %v", err)
+	}
+	for i := range pods.Items {
+		if err := tr.indexer.Update(&pods.Items[i]); err != nil {
+			t.Fatalf("failed to update cache: %v", err)
+		}
+	}
+
+	services, err := tr.client.CoreV1().Services("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	objects := make([]interface{}, 0, len(services.Items))
+	for i := range services.Items {
+		objects = append(objects, &services.Items[i])
+	}
+	if err := tr.services.Replace(objects, ""); err != nil {
+		t.Fatalf("failed to update cache: %v", err)
+	}
+
+	slices, err := tr.client.DiscoveryV1().EndpointSlices("").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list endpointslices: %v", err)
+	}
+	objects = make([]interface{}, 0, len(slices.Items))
+	for i := range slices.Items {
+		objects = append(objects, &slices.Items[i])
+	}
+	if err := tr.slices.Replace(objects, ""); err != nil {
+		t.Fatalf("failed to update cache: %v", err)
+	}
+}
+
+func TestSetCurrentMasterWithClient(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+
+	tests := []struct {
+		name          string
+		masterAddress []string
+		patchErr      error
+		expectError   bool
+		expectChanged int
+		expectLabels  map[string]string
+	}{
+		{
+			name:          "moves master label to new master",
+			masterAddress: []string{"10.244.1.5", "6379"},
+			expectChanged: 2,
+			expectLabels: map[string]string{
+				"valkey-0": "true",
+				"valkey-1": "",
+			},
+		},
+		{
+			name:          "no pod matches master IP",
+			masterAddress: []string{"10.244.1.99", "6379"},
+			expectError:   true,
+		},
+		{
+			name:          "patch failure is returned",
+			masterAddress: []string{"10.244.1.5", "6379"},
+			patchErr:      fmt.Errorf("the server is currently unable to handle the request"),
+			expectError:   true,
+		},
+		{
+			name:          "malformed master address",
+			masterAddress: []string{"10.244.1.5"},
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReconciler(t, config,
+				newValkeyPod("valkey-0", "10.244.1.5", nil),
+				newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+			)
+			if tt.patchErr != nil {
+				r.client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.patchErr
+				})
+			}
+
+			ctx := context.Background()
+			changed, err := r.setCurrentMaster(ctx, tt.masterAddress, "test")
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("setCurrentMaster() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+			}
+			if changed != tt.expectChanged {
+				t.Errorf("setCurrentMaster() changed = %d, want %d", changed, tt.expectChanged)
+			}
+
+			for name, expected := range tt.expectLabels {
+				pod, err := r.client.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("failed to get pod %s: %v", name, err)
+				}
+				if pod.Labels["vk-master"] != expected {
+					t.Errorf("pod %s vk-master = %q, want %q", name, pod.Labels["vk-master"], expected)
+				}
+			}
+
+			// A second pass over already-correct labels must not write anything.
+			r.syncCache(t)
+			changed, err = r.setCurrentMaster(ctx, tt.masterAddress, "test")
+			if err != nil || changed != 0 {
+				t.Errorf("second setCurrentMaster() = (%d, %v), want (0, nil)", changed, err)
+			}
+		})
+	}
+}
+
+func TestSetCurrentMasterDemotion(t *testing.T) {
+	tests := []struct {
+		name         string
+		replicaValue string
+		labels       map[string]map[string]string
+		expectLabels map[string]*string
+	}{
+		{
+			name: "demotion removes the label key",
+			labels: map[string]map[string]string{
+				"valkey-1": {"vk-role": "master"},
+			},
+			expectLabels: map[string]*string{
+				"valkey-0": ptr("master"),
+				"valkey-1": nil,
+				"valkey-2": nil,
+			},
+		},
+		{
+			name: "empty label left by older versions is removed",
+			labels: map[string]map[string]string{
+				"valkey-2": {"vk-role": ""},
+			},
+			expectLabels: map[string]*string{
+				"valkey-0": ptr("master"),
+				"valkey-2": nil,
+			},
+		},
+		{
+			name:         "replica mode labels every non-master pod",
+			replicaValue: "replica",
+			labels: map[string]map[string]string{
+				"valkey-1": {"vk-role": "master"},
+			},
+			expectLabels: map[string]*string{
+				"valkey-0": ptr("master"),
+				"valkey-1": ptr("replica"),
+				"valkey-2": ptr("replica"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Namespace:            "default",
+				MasterPodLabelName:   "vk-role",
+				MasterPodLabelValue:  "master",
+				ReplicaPodLabelValue: tt.replicaValue,
+			}
+			r := newTestReconciler(t, config,
+				newValkeyPod("valkey-0", "10.244.1.5", tt.labels["valkey-0"]),
+				newValkeyPod("valkey-1", "10.244.1.6", tt.labels["valkey-1"]),
+				newValkeyPod("valkey-2", "10.244.1.7", tt.labels["valkey-2"]),
+			)
+
+			ctx := context.Background()
+			if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err != nil {
+				t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+			}
+
+			for name, expected := range tt.expectLabels {
+				pod, err := r.client.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("failed to get pod %s: %v", name, err)
+				}
+				value, ok := pod.Labels["vk-role"]
+				switch {
+				case expected == nil && ok:
+					t.Errorf("pod %s has vk-role=%q, want label absent", name, value)
+				case expected != nil && (!ok || value != *expected):
+					t.Errorf("pod %s vk-role = %q (present %v), want %q", name, value, ok, *expected)
+				}
+			}
+
+			r.syncCache(t)
+			if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err != nil || changed != 0 {
+				t.Errorf("second setCurrentMaster() = (%d, %v), want (0, nil)", changed, err)
+			}
+		})
+	}
+}
+
+func TestSetCurrentMasterHealthyReplicas(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		HealthyReplicaLabel: "vk-replica",
+		HealthyReplicaValue: "true",
+	}
+
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-replica": "true"}),
+		newValkeyPod("valkey-1", "10.244.1.6", nil),
+		newValkeyPod("valkey-2", "10.244.1.7", map[string]string{"vk-replica": "true"}),
+	)
+	// valkey-0 was just promoted and sentinel still lists it, valkey-2 is down.
+	r.healthyReplicas = func(ctx context.Context, masterName string) ([]string, error) {
+		return []string{"10.244.1.5:6379", "10.244.1.6:6379"}, nil
+	}
+
+	ctx := context.Background()
+	changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test")
+	if err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	if changed != 4 {
+		t.Errorf("setCurrentMaster() changed = %d, want 4", changed)
+	}
+
+	expected := map[string]*string{
+		"valkey-0": nil,
+		"valkey-1": ptr("true"),
+		"valkey-2": nil,
+	}
+	for name, want := range expected {
+		pod, err := r.client.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod %s: %v", name, err)
+		}
+		value, ok := pod.Labels["vk-replica"]
+		switch {
+		case want == nil && ok:
+			t.Errorf("pod %s has vk-replica=%q, want label absent", name, value)
+		case want != nil && (!ok || value != *want):
+			t.Errorf("pod %s vk-replica = %q (present %v), want %q", name, value, ok, *want)
+		}
+	}
+
+	r.healthyReplicas = func(ctx context.Context, masterName string) ([]string, error) {
+		return nil, fmt.Errorf("sentinel connection failed")
+	}
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err == nil {
+		t.Errorf("setCurrentMaster() expected error when replicas cannot be queried")
+	}
+}
+
+func TestSetCurrentMasterHealthyReplicasSharingAnAddress(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		HealthyReplicaLabel: "vk-replica",
+		HealthyReplicaValue: "true",
+	}
+
+	// valkey-1 and valkey-2 share a node's network; only valkey-1 is healthy.
+	pods := []*corev1.Pod{
+		newHostNetworkPod("valkey-0", "10.0.0.1", 6379, nil),
+		newHostNetworkPod("valkey-1", "10.0.0.2", 6379, nil),
+		newHostNetworkPod("valkey-2", "10.0.0.2", 6380, nil),
+	}
+	for _, pod := range pods {
+		pod.Labels = newValkeyPod(pod.Name, "", nil).Labels
+	}
+	r := newTestReconciler(t, config, pods...)
+	r.healthyReplicas = func(ctx context.Context, masterName string) ([]string, error) {
+		return []string{"10.0.0.2:6379"}, nil
+	}
+
+	ctx := context.Background()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.0.0.1", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	for name, want := range map[string]bool{"valkey-0": false, "valkey-1": true, "valkey-2": false} {
+		pod, err := r.client.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod %s: %v", name, err)
+		}
+		if _, ok := pod.Labels["vk-replica"]; ok != want {
+			t.Errorf("pod %s has the healthy replica label = %v, want %v", name, ok, want)
+		}
+	}
+}
+
+func TestSetCurrentMasterScopedToSelector(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		PodSelector:         "app.kubernetes.io/name=valkey,app.kubernetes.io/instance=vk",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+
+	other := newValkeyPod("cache-0", "10.244.2.5", map[string]string{"vk-master": "true"})
+	other.Labels["app.kubernetes.io/instance"] = "cache"
+
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		other,
+	)
+
+	ctx := context.Background()
+	changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test")
+	if err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	if changed != 1 {
+		t.Errorf("setCurrentMaster() changed = %d, want 1", changed)
+	}
+
+	pod, err := r.client.CoreV1().Pods("default").Get(ctx, "cache-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod cache-0: %v", err)
+	}
+	if pod.Labels["vk-master"] != "true" {
+		t.Errorf("pod cache-0 of another release was relabelled: %v", pod.Labels)
+	}
+}
+
+func TestSetCurrentMasterDryRun(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterName:          "dryrun",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		DryRun:              true,
+	}
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+	)
+
+	ctx := context.Background()
+	changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test")
+	if err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("setCurrentMaster() changed = %d, want 2", changed)
+	}
+	for _, action := range r.client.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("setCurrentMaster() patched pod %s in dry-run mode", action.(k8stesting.PatchAction).GetName())
+		}
+	}
+
+	if got := testutil.ToFloat64(dryRunLabelChanges.WithLabelValues("default", "dryrun", "valkey-0", "vk-master", "add")); got != 1 {
+		t.Errorf("dry-run add on valkey-0 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(dryRunLabelChanges.WithLabelValues("default", "dryrun", "valkey-1", "vk-master", "remove")); got != 1 {
+		t.Errorf("dry-run remove on valkey-1 = %v, want 1", got)
+	}
+
+	// The labels already match the next master, so the diff is cleared.
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.6", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	if n := dryRunLabelChanges.DeletePartialMatch(prometheus.Labels{"master_name": "dryrun"}); n != 0 {
+		t.Errorf("dry-run changes after labels match = %d, want 0", n)
+	}
+}
+
+func TestSetCurrentMasterByHostname(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	master := newValkeyPod("valkey-0", "10.244.1.5", nil)
+	master.Spec.Hostname = "valkey-0"
+	master.Spec.Subdomain = "vk-valkey-headless"
+	r := newTestReconciler(t, config,
+		master,
+		newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+	)
+
+	ctx := context.Background()
+	// The name does not resolve outside a cluster, so the pod is found by
+	// its hostname alone.
+	changed, err := r.setCurrentMaster(ctx, []string{"valkey-0.vk-valkey-headless.default.svc.cluster.local", "6379"}, "test")
+	if err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("setCurrentMaster() changed = %d, want 2", changed)
+	}
+	for name, want := range map[string]string{"valkey-0": "true", "valkey-1": ""} {
+		pod, err := r.client.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod %s: %v", name, err)
+		}
+		if got := pod.Labels["vk-master"]; got != want {
+			t.Errorf("pod %s vk-master = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSetCurrentMasterByPort(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	// Both instances run on the host network of the same node.
+	onPort := func(pod *corev1.Pod, port int32) *corev1.Pod {
+		pod.Spec.Containers = []corev1.Container{{Name: "valkey", Ports: []corev1.ContainerPort{{ContainerPort: port}}}}
+		return pod
+	}
+	r := newTestReconciler(t, config,
+		onPort(newValkeyPod("valkey-0", "10.0.0.1", map[string]string{"vk-master": "true"}), 6379),
+		onPort(newValkeyPod("valkey-1", "10.0.0.1", nil), 6380),
+	)
+
+	ctx := context.Background()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.0.0.1", "6380"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	for name, want := range map[string]string{"valkey-0": "", "valkey-1": "true"} {
+		pod, err := r.client.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod %s: %v", name, err)
+		}
+		if got := pod.Labels["vk-master"]; got != want {
+			t.Errorf("pod %s vk-master = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSetCurrentMasterUnresolvableAddressKeepsLabels(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+	)
+
+	_, err := r.setCurrentMaster(context.Background(), []string{"valkey-9.invalid", "6379"}, "test")
+	if err == nil {
+		t.Fatal("setCurrentMaster() expected error for an unresolvable address")
+	}
+	for _, action := range r.client.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("setCurrentMaster() patched pod %s for an unresolvable address", action.(k8stesting.PatchAction).GetName())
+		}
+	}
+}
+
+func TestSetCurrentMasterRecordsEvents(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+		newValkeyPod("valkey-2", "10.244.1.7", map[string]string{"vk-master": ""}),
+	)
+
+	if _, err := r.setCurrentMaster(context.Background(), []string{"10.244.1.5", "6379"}, "+switch-master event"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+
+	// Cleaning up the stale empty label on valkey-2 is not a demotion. The
+	// pod cache lists pods in no particular order.
+	want := map[string]bool{
+		"Normal MasterPromoted Promoted to master of myprimary at 10.244.1.5:6379 (+switch-master event)":             true,
+		"Normal MasterDemoted Demoted from master of myprimary, new master is 10.244.1.5:6379 (+switch-master event)": true,
+	}
+	for len(want) > 0 {
+		select {
+		case got := <-r.recorder.Events:
+			if !want[got] {
+				t.Errorf("unexpected event %q", got)
+			}
+			delete(want, got)
+		default:
+			for event := range want {
+				t.Errorf("missing event %q", event)
+			}
+			return
+		}
+	}
+	select {
+	case got := <-r.recorder.Events:
+		t.Errorf("unexpected event %q", got)
+	default:
+	}
+}
+
+func TestSetCurrentMasterDemotesBeforePromoting(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+
+	for i := 0; i < 10; i++ {
+		r := newTestReconciler(t, config,
+			newValkeyPod("valkey-0", "10.244.1.5", nil),
+			newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+			newValkeyPod("valkey-2", "10.244.1.7", map[string]string{"vk-master": "true"}),
+		)
+		if _, err := r.setCurrentMaster(context.Background(), []string{"10.244.1.5", "6379"}, "test"); err != nil {
+			t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+		}
+
+		var patched []string
+		for _, action := range r.client.Actions() {
+			if patch, ok := action.(k8stesting.PatchAction); ok {
+				patched = append(patched, patch.GetName())
+			}
+		}
+		if len(patched) != 3 || patched[2] != "valkey-0" {
+			t.Fatalf("patch order = %v, want the new master valkey-0 last", patched)
+		}
+	}
+}
+
+func TestSetCurrentMasterFailedDemotionBlocksPromotion(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+	)
+	r.client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.PatchAction).GetName() == "valkey-1" {
+			return true, nil, fmt.Errorf("the server is currently unable to handle the request")
+		}
+		return false, nil, nil
+	})
+
+	ctx := context.Background()
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err == nil {
+		t.Fatalf("setCurrentMaster() expected error when the old master cannot be demoted")
+	}
+	pod, err := r.client.CoreV1().Pods("default").Get(ctx, "valkey-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod valkey-0: %v", err)
+	}
+	if _, ok := pod.Labels["vk-master"]; ok {
+		t.Errorf("new master was labelled while the old master kept its label")
+	}
+}
+
+func TestSetCurrentMasterSingleMasterInvariant(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterName:          "invariant",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	// Two pods sharing the master IP, as with hostNetwork, both match, so
+	// neither is labelled.
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.5", nil),
+		newValkeyPod("valkey-2", "10.244.1.7", map[string]string{"vk-master": "true"}),
+	)
+
+	ctx := context.Background()
+	_, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test")
+	if err == nil || !strings.Contains(err.Error(), "matches 2 pods") {
+		t.Errorf("setCurrentMaster() error = %v, want ambiguous master error", err)
+	}
+	for _, action := range r.client.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("setCurrentMaster() patched pod %s for an ambiguous master", action.(k8stesting.PatchAction).GetName())
+		}
+	}
+
+	// Pods sharing the master IP, none of which serves the reported port,
+	// are just as ambiguous: the current master keeps its label.
+	shared := []*corev1.Pod{
+		newHostNetworkPod("valkey-0", "10.0.0.1", 6379, nil),
+		newHostNetworkPod("valkey-1", "10.0.0.1", 6380, nil),
+	}
+	for _, pod := range shared {
+		pod.Labels = newValkeyPod(pod.Name, "", nil).Labels
+	}
+	shared[0].Labels["vk-master"] = "true"
+	r = newTestReconciler(t, config, shared...)
+	_, err = r.setCurrentMaster(ctx, []string{"10.0.0.1", "6390"}, "test")
+	if err == nil || !strings.Contains(err.Error(), "matches 2 pods") {
+		t.Errorf("setCurrentMaster() error = %v, want ambiguous master error", err)
+	}
+	pod, err := r.client.CoreV1().Pods("default").Get(ctx, "valkey-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod: %v", err)
+	}
+	if pod.Labels["vk-master"] != "true" {
+		t.Errorf("valkey-0 master label = %q, want it kept", pod.Labels["vk-master"])
+	}
+
+	// Two stale labels that cannot be removed are reported.
+	r = newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+		newValkeyPod("valkey-2", "10.244.1.7", map[string]string{"vk-master": "true"}),
+	)
+	r.client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("the server is currently unable to handle the request")
+	})
+	_, err = r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test")
+	if err == nil || !strings.Contains(err.Error(), "2 pods carry the master label") {
+		t.Errorf("setCurrentMaster() error = %v, want invariant violation", err)
+	}
+	if got := testutil.ToFloat64(masterLabelledPods.WithLabelValues("default", "invariant")); got != 2 {
+		t.Errorf("master_labelled_pods = %v, want 2", got)
+	}
+}
+
+func TestSetCurrentMasterVerifiesRole(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterName:          "verified",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		VerifyMasterRole:    true,
+	}
+	r := newTestReconciler(t, config, newValkeyPod("valkey-0", "10.244.1.5", nil))
+	ctx := context.Background()
+
+	mismatches := masterRoleMismatchesTotal.WithLabelValues("default", "verified")
+	before := testutil.ToFloat64(mismatches)
+
+	var queried string
+	role := "slave"
+	r.nodeRole = func(ctx context.Context, addr string) (string, error) {
+		queried = addr
+		return role, nil
+	}
+
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err == nil || !strings.Contains(err.Error(), "reports role slave") {
+		t.Errorf("setCurrentMaster() error = %v, want role mismatch", err)
+	}
+	if queried != "10.244.1.5:6379" {
+		t.Errorf("queried role at %q, want %q", queried, "10.244.1.5:6379")
+	}
+	pod, _ := r.client.CoreV1().Pods("default").Get(ctx, "valkey-0", metav1.GetOptions{})
+	if _, ok := pod.Labels["vk-master"]; ok {
+		t.Errorf("pod reporting role slave was labelled as master")
+	}
+	if event := <-r.recorder.Events; !strings.HasPrefix(event, "Warning MasterRoleMismatch") {
+		t.Errorf("event = %q, want MasterRoleMismatch warning", event)
+	}
+	if got := testutil.ToFloat64(mismatches) - before; got != 1 {
+		t.Errorf("master_role_mismatches_total increased by %v, want 1", got)
+	}
+
+	// Once the node finishes its promotion the label is applied.
+	role = "master"
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err != nil || changed != 1 {
+		t.Errorf("setCurrentMaster() = (%d, %v), want (1, nil)", changed, err)
+	}
+}
+
+func TestSetCurrentMasterUnverifiedKeepsCurrentMaster(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		VerifyMasterRole:    true,
+	}
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", nil),
+		newValkeyPod("valkey-1", "10.244.1.6", map[string]string{"vk-master": "true"}),
+	)
+	r.nodeRole = func(ctx context.Context, addr string) (string, error) {
+		return "slave", nil
+	}
+
+	ctx := context.Background()
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "test"); err == nil || changed != 0 {
+		t.Errorf("setCurrentMaster() = (%d, %v), want (0, role mismatch)", changed, err)
+	}
+	for _, action := range r.client.Actions() {
+		if action.GetVerb() == "patch" {
+			t.Errorf("setCurrentMaster() patched a pod after a failed role check")
+		}
+	}
+	pod, err := r.client.CoreV1().Pods("default").Get(ctx, "valkey-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod: %v", err)
+	}
+	if pod.Labels["vk-master"] != "true" {
+		t.Errorf("valkey-1 master label = %q, want it kept", pod.Labels["vk-master"])
+	}
+}
+
+func TestMarkMasterDown(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		DropMasterOnODown:   true,
+	}
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-master": "true"}),
+		newValkeyPod("valkey-1", "10.244.1.6", nil),
+	)
+	r.downMasterAddr = func(ctx context.Context, masterName string) (string, error) {
+		return "10.244.1.5:6379", nil
+	}
+	ctx := context.Background()
+
+	masterLabels := func() map[string]string {
+		t.Helper()
+		r.syncCache(t)
+		labels := make(map[string]string)
+		for _, name := range []string{"valkey-0", "valkey-1"} {
+			pod, err := r.client.CoreV1().Pods("default").Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get pod %s: %v", name, err)
+			}
+			if value, ok := pod.Labels["vk-master"]; ok {
+				labels[name] = value
+			}
+		}
+		return labels
+	}
+
+	if _, err := r.markMasterDown(ctx, []string{"10.244.1.5", "6379"}, "+odown event"); err != nil {
+		t.Fatalf("markMasterDown() unexpected error: %v", err)
+	}
+	if labels := masterLabels(); len(labels) != 0 {
+		t.Errorf("master labels after odown = %v, want none", labels)
+	}
+	if event := <-r.recorder.Events; !strings.HasPrefix(event, "Normal MasterDemoted") {
+		t.Errorf("event = %q, want MasterDemoted", event)
+	}
+
+	// A resync while sentinel still reports the down master keeps it unlabelled.
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "periodic resync"); err != nil || changed != 0 {
+		t.Errorf("setCurrentMaster() during odown = (%d, %v), want (0, nil)", changed, err)
+	}
+
+	// The switch-master event labels the new master and ends the odown state.
+	if _, err := r.setCurrentMaster(ctx, []string{"10.244.1.6", "6379"}, "+switch-master event"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+	if labels := masterLabels(); len(labels) != 1 || labels["valkey-1"] != "true" {
+		t.Errorf("master labels after switch-master = %v, want only valkey-1", labels)
+	}
+	if r.downMaster != "" {
+		t.Errorf("downMaster = %q after switch-master, want empty", r.downMaster)
+	}
+}
+
+func TestMarkMasterDownBeforeSentinelsAgree(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		DropMasterOnODown:   true,
+	}
+	r := newTestReconciler(t, config,
+		newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-master": "true"}),
+		newValkeyPod("valkey-1", "10.244.1.6", nil),
+	)
+	// The sentinels asked have not flagged the master o_down yet.
+	r.downMasterAddr = func(ctx context.Context, masterName string) (string, error) {
+		return "", nil
+	}
+
+	ctx := context.Background()
+	if _, err := r.markMasterDown(ctx, []string{"10.244.1.5", "6379"}, "+odown event"); err != nil {
+		t.Fatalf("markMasterDown() unexpected error: %v", err)
+	}
+	pod, err := r.client.CoreV1().Pods("default").Get(ctx, "valkey-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod: %v", err)
+	}
+	if _, ok := pod.Labels["vk-master"]; ok {
+		t.Errorf("master label = %q after odown, want none", pod.Labels["vk-master"])
+	}
+	if r.downMaster != "10.244.1.5:6379" {
+		t.Errorf("downMaster = %q, want 10.244.1.5:6379", r.downMaster)
+	}
+}
+
+func TestMarkMasterUp(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		DropMasterOnODown:   true,
+	}
+	r := newTestReconciler(t, config, newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-master": "true"}))
+	down := "10.244.1.5:6379"
+	r.downMasterAddr = func(ctx context.Context, masterName string) (string, error) {
+		return down, nil
+	}
+	ctx := context.Background()
+
+	if _, err := r.markMasterDown(ctx, []string{"10.244.1.5", "6379"}, "+odown event"); err != nil {
+		t.Fatalf("markMasterDown() unexpected error: %v", err)
+	}
+	r.syncCache(t)
+
+	// The master recovered without a failover.
+	down = ""
+	r.markMasterUp()
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "master no longer objectively down"); err != nil || changed != 1 {
+		t.Errorf("setCurrentMaster() after -odown = (%d, %v), want (1, nil)", changed, err)
+	}
+}
+
+func TestSetCurrentMasterReadsODownFromSentinel(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+		DropMasterOnODown:   true,
+	}
+	r := newTestReconciler(t, config, newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-master": "true"}))
+	down := "10.244.1.5:6379"
+	var downErr error
+	r.downMasterAddr = func(ctx context.Context, masterName string) (string, error) {
+		return down, downErr
+	}
+	ctx := context.Background()
+
+	if _, err := r.markMasterDown(ctx, []string{"10.244.1.5", "6379"}, "+odown event"); err != nil {
+		t.Fatalf("markMasterDown() unexpected error: %v", err)
+	}
+	r.syncCache(t)
+
+	// While sentinel cannot be asked, the master stays unlabelled.
+	downErr = fmt.Errorf("connection refused")
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "periodic resync"); err != nil || changed != 0 {
+		t.Errorf("setCurrentMaster() without sentinel state = (%d, %v), want (0, nil)", changed, err)
+	}
+
+	// Only -odown, +switch-master or a reconnect relabel the master.
+	down, downErr = "", nil
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "periodic resync"); err != nil || changed != 0 {
+		t.Errorf("setCurrentMaster() without the o_down flag = (%d, %v), want (0, nil)", changed, err)
+	}
+	r.markMasterUp()
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "-odown event"); err != nil || changed != 1 {
+		t.Errorf("setCurrentMaster() after -odown = (%d, %v), want (1, nil)", changed, err)
+	}
+	r.syncCache(t)
+
+	// The +odown event was missed, but the next resync sees the flag.
+	down = "10.244.1.5:6379"
+	if changed, err := r.setCurrentMaster(ctx, []string{"10.244.1.5", "6379"}, "periodic resync"); err != nil || changed != 1 {
+		t.Errorf("setCurrentMaster() after a missed +odown = (%d, %v), want (1, nil)", changed, err)
+	}
+	if r.downMaster != down {
+		t.Errorf("downMaster = %q after sentinel flags the master, want %q", r.downMaster, down)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestSetCurrentMasterUsesPodCache(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	r := newTestReconciler(t, config, newValkeyPod("valkey-0", "10.244.1.5", nil))
+
+	if _, err := r.setCurrentMaster(context.Background(), []string{"10.244.1.5", "6379"}, "test"); err != nil {
+		t.Fatalf("setCurrentMaster() unexpected error: %v", err)
+	}
+
+	for _, action := range r.client.Actions() {
+		switch action.GetVerb() {
+		case "list":
+			t.Errorf("setCurrentMaster() listed pods from the API server instead of the cache")
+		case "update":
+			t.Errorf("setCurrentMaster() used a full pod update instead of a patch")
+		}
+	}
+
+	cached, _ := r.pods.Pods("default").Get("valkey-0")
+	if cached.Labels["vk-master"] != "" {
+		t.Errorf("setCurrentMaster() mutated the cached pod object")
+	}
+}
+
+func TestPatchPodLabel(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	pod := newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"team": "cache"})
+	r := newTestReconciler(t, config, pod)
+
+	var patches []string
+	throttled := 1
+	r.client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		if patchAction.GetPatchType() != types.MergePatchType {
+			t.Errorf("patch type = %s, want %s", patchAction.GetPatchType(), types.MergePatchType)
+		}
+		patches = append(patches, string(patchAction.GetPatch()))
+		if throttled > 0 {
+			throttled--
+			return true, nil, apierrors.NewTooManyRequests("slow down", 0)
+		}
+		return false, nil, nil
+	})
+
+	if err := r.patchPodLabel(context.Background(), pod, "vk-master", ptr("true")); err != nil {
+		t.Fatalf("patchPodLabel() unexpected error: %v", err)
+	}
+
+	if len(patches) != 2 {
+		t.Fatalf("expected a retry after throttling, got %d patch calls", len(patches))
+	}
+	if want := `{"metadata":{"labels":{"vk-master":"true"}}}`; patches[1] != want {
+		t.Errorf("patch = %s, want %s", patches[1], want)
+	}
+
+	updated, err := r.client.CoreV1().Pods("default").Get(context.Background(), "valkey-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod: %v", err)
+	}
+	if updated.Labels["vk-master"] != "true" || updated.Labels["team"] != "cache" {
+		t.Errorf("labels after patch = %v, want vk-master=true and team=cache", updated.Labels)
+	}
+}
+
+func TestPatchPodLabelDoesNotRetryOtherErrors(t *testing.T) {
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+	pod := newValkeyPod("valkey-0", "10.244.1.5", nil)
+	r := newTestReconciler(t, config, pod)
+
+	calls := 0
+	r.client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		return true, nil, apierrors.NewForbidden(corev1.Resource("pods"), pod.Name, fmt.Errorf("denied"))
+	})
+
+	if err := r.patchPodLabel(context.Background(), pod, "vk-master", ptr("true")); !apierrors.IsForbidden(err) {
+		t.Errorf("patchPodLabel() error = %v, want forbidden", err)
+	}
+	if calls != 1 {
+		t.Errorf("patchPodLabel() made %d patch calls for a forbidden error, want 1", calls)
+	}
+}
+
+func TestReconcileWithRetry(t *testing.T) {
+	previous := reconcileBackoff
+	reconcileBackoff.Duration = time.Millisecond
+	reconcileBackoff.Steps = 3
+	defer func() { reconcileBackoff = previous }()
+
+	config := &Config{
+		Namespace:           "default",
+		MasterPodLabelName:  "vk-master",
+		MasterPodLabelValue: "true",
+	}
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		r := newTestReconciler(t, config, newValkeyPod("valkey-0", "10.244.1.5", nil))
+		failures := 2
+		r.client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if failures > 0 {
+				failures--
+				return true, nil, fmt.Errorf("connection refused")
+			}
+			return false, nil, nil
+		})
+
+		changed, err := r.reconcileWithRetry(context.Background(), []string{"10.244.1.5", "6379"}, "test")
+		if err != nil {
+			t.Fatalf("reconcileWithRetry() unexpected error: %v", err)
+		}
+		if changed != 1 {
+			t.Errorf("reconcileWithRetry() changed = %d, want 1", changed)
+		}
+		if failures != 0 {
+			t.Errorf("expected all transient failures to be consumed, %d left", failures)
+		}
+	})
+
+	t.Run("returns last error when retries are exhausted", func(t *testing.T) {
+		r := newTestReconciler(t, config, newValkeyPod("valkey-0", "10.244.1.5", nil))
+		r.client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("connection refused")
+		})
+
+		_, err := r.reconcileWithRetry(context.Background(), []string{"10.244.1.5", "6379"}, "test")
+		if err == nil || !strings.Contains(err.Error(), "connection refused") {
+			t.Errorf("reconcileWithRetry() = %v, want connection refused error", err)
+		}
+	})
+
+	t.Run("stops when context is cancelled", func(t *testing.T) {
+		r := newTestReconciler(t, config)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := r.reconcileWithRetry(ctx, []string{"10.244.1.5", "6379"}, "test"); err == nil {
+			t.Errorf("reconcileWithRetry() with cancelled context expected error, got nil")
+		}
+	})
+}
+
+func TestPodChangeReason(t *testing.T) {
+	r := &Reconciler{group: MasterGroup{MasterPodLabelName: "vk-master"}}
+
+	tests := []struct {
+		name          string
+		oldPod        *corev1.Pod
+		newPod        *corev1.Pod
+		expectTrigger bool
+	}{
+		{
+			name:          "IP change triggers reconciliation",
+			oldPod:        newValkeyPod("valkey-0", "10.244.1.5", nil),
+			newPod:        newValkeyPod("valkey-0", "10.244.1.9", nil),
+			expectTrigger: true,
+		},
+		{
+			name:          "pod gaining an IP triggers reconciliation",
+			oldPod:        newValkeyPod("valkey-0", "", nil),
+			newPod:        newValkeyPod("valkey-0", "10.244.1.9", nil),
+			expectTrigger: true,
+		},
+		{
+			name:          "manual master label edit triggers reconciliation",
+			oldPod:        newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-master": "true"}),
+			newPod:        newValkeyPod("valkey-0", "10.244.1.5", nil),
+			expectTrigger: true,
+		},
+		{
+			name:          "empty master label removal triggers reconciliation",
+			oldPod:        newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"vk-master": ""}),
+			newPod:        newValkeyPod("valkey-0", "10.244.1.5", nil),
+			expectTrigger: true,
+		},
+		{
+			name:          "unrelated label change is ignored",
+			oldPod:        newValkeyPod("valkey-0", "10.244.1.5", nil),
+			newPod:        newValkeyPod("valkey-0", "10.244.1.5", map[string]string{"team": "cache"}),
+			expectTrigger: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := r.podChangeReason(tt.oldPod, tt.newPod)
+			if tt.expectTrigger && reason == "" {
+				t.Errorf("podChangeReason() = \"\", want a reason")
+			}
+			if !tt.expectTrigger && reason != "" {
+				t.Errorf("podChangeReason() = %q, want \"\"", reason)
+			}
+		})
+	}
+}
+
+func TestNotifyPodEventCoalesces(t *testing.T) {
+	r := &Reconciler{podEvents: make(chan string, 1)}
+
+	r.notifyPodEvent("pod valkey-0 added")
+	r.notifyPodEvent("pod valkey-1 added")
+
+	if got := <-r.podEvents; got != "pod valkey-0 added" {
+		t.Errorf("first notification = %q, want %q", got, "pod valkey-0 added")
+	}
+	select {
+	case got := <-r.podEvents:
+		t.Errorf("unexpected second notification %q", got)
+	default:
+	}
+}
+
+func TestPodInformerNotifiesOnChurn(t *testing.T) {
+	config := &Config{
+		Namespace:          "default",
+		MasterPodLabelName: "vk-master",
+	}
+	group := MasterGroup{
+		Name:               "myprimary",
+		PodSelector:        defaultPodSelector,
+		MasterPodLabelName: config.MasterPodLabelName,
+	}
+	client := fake.NewSimpleClientset()
+	r, factory, err := newReconciler(config, group, client, record.NewFakeRecorder(100))
+	if err != nil {
+		t.Fatalf("newReconciler() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	factory.Start(ctx.Done())
+	if !r.waitForCacheSync(ctx) {
+		t.Fatalf("pod cache did not sync")
+	}
+
+	if _, err := client.CoreV1().Pods("default").Create(ctx, newValkeyPod("valkey-0", "10.244.1.5", nil), metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create pod: %v", err)
+	}
+
+	select {
+	case reason := <-r.podEvents:
+		if !strings.Contains(reason, "valkey-0") {
+			t.Errorf("notification %q does not mention the pod", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no notification for added pod")
+	}
+}
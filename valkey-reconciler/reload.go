@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// filesChanged stats files and reports whether any of them changed since
+// last, the modification times recorded when they were previously read. It
+// also returns the current times, which the caller records once it has read
+// the files successfully. Empty names are skipped, and a nil last always
+// counts as a change so the first call loads the files.
+func filesChanged(last map[string]time.Time, files ...string) (map[string]time.Time, bool, error) {
+	changed := last == nil
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, false, err
+		}
+		modTimes[file] = info.ModTime()
+		if !info.ModTime().Equal(last[file]) {
+			changed = true
+		}
+	}
+	return modTimes, changed, nil
+}
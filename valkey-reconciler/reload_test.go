@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilesChanged(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(file, []byte("first"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	modTimes, changed, err := filesChanged(nil, file, "")
+	if err != nil || !changed {
+		t.Fatalf("filesChanged() on first load = (%v, %v), want (true, nil)", changed, err)
+	}
+	if len(modTimes) != 1 {
+		t.Errorf("filesChanged() recorded %v, want only %s", modTimes, file)
+	}
+
+	if _, changed, err := filesChanged(modTimes, file, ""); err != nil || changed {
+		t.Errorf("filesChanged() without a change = (%v, %v), want (false, nil)", changed, err)
+	}
+
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, future, future); err != nil {
+		t.Fatalf("failed to touch file: %v", err)
+	}
+	if _, changed, err := filesChanged(modTimes, file, ""); err != nil || !changed {
+		t.Errorf("filesChanged() after a change = (%v, %v), want (true, nil)", changed, err)
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if _, _, err := filesChanged(modTimes, file); err == nil {
+		t.Errorf("filesChanged() expected an error for a missing file")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NodeClient is the subset of a Valkey node connection used to check its
+// replication role.
+type NodeClient interface {
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
+	Info(ctx context.Context, section ...string) *redis.StringCmd
+}
+
+// nodeOptions returns the client options for the Valkey node at addr. The node
+// credentials and TLS settings default to the sentinel ones.
+func nodeOptions(config *Config, addr string) *redis.Options {
+	options := &redis.Options{
+		Addr:      addr,
+		Username:  config.NodeUsername,
+		Password:  config.NodePassword,
+		TLSConfig: connectionTLSConfig(config.NodeTLSConfig, addr),
+	}
+	if config.NodeCredentials != nil {
+		options.CredentialsProvider = config.NodeCredentials.credentials
+	}
+	return options
+}
+
+// getNodeRole connects to the Valkey node at addr and returns the role it
+// reports, such as "master" or "slave".
+func getNodeRole(ctx context.Context, config *Config, addr string) (string, error) {
+	client := redis.NewClient(nodeOptions(config, addr))
+	defer client.Close()
+	return nodeRole(ctx, client)
+}
+
+// nodeRole asks node for its role with ROLE, falling back to the role field of
+// INFO replication where ROLE is renamed or disabled.
+func nodeRole(ctx context.Context, node NodeClient) (string, error) {
+	reply, err := node.Do(ctx, "ROLE").Slice()
+	if err == nil && len(reply) > 0 {
+		if role, ok := reply[0].(string); ok {
+			return role, nil
+		}
+	}
+
+	info, infoErr := node.Info(ctx, "replication").Result()
+	if infoErr != nil {
+		if err != nil {
+			return "", fmt.Errorf("failed to get role: %w", err)
+		}
+		return "", fmt.Errorf("failed to get replication info: %w", infoErr)
+	}
+	for _, line := range strings.Split(info, "\n") {
+		if role, ok := strings.CutPrefix(strings.TrimSpace(line), "role:"); ok {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("no role in replication info")
+}
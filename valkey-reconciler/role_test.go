@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type mockNodeClient struct {
+	role    []interface{}
+	roleErr error
+	info    string
+	infoErr error
+}
+
+func (m *mockNodeClient) Do(ctx context.Context, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(m.role, m.roleErr)
+}
+
+func (m *mockNodeClient) Info(ctx context.Context, section ...string) *redis.StringCmd {
+	return redis.NewStringResult(m.info, m.infoErr)
+}
+
+func TestNodeRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		node         *mockNodeClient
+		expectedRole string
+		expectError  bool
+	}{
+		{
+			name:         "master from ROLE",
+			node:         &mockNodeClient{role: []interface{}{"master", int64(3129659), []interface{}{}}},
+			expectedRole: "master",
+		},
+		{
+			name:         "replica from ROLE",
+			node:         &mockNodeClient{role: []interface{}{"slave", "10.244.1.5", int64(6379), "connected", int64(3167038)}},
+			expectedRole: "slave",
+		},
+		{
+			name: "fallback to INFO replication",
+			node: &mockNodeClient{
+				roleErr: errors.New("ERR unknown command 'ROLE'"),
+				info:    "# Replication\r\nrole:slave\r\nmaster_host:10.244.1.5\r\n",
+			},
+			expectedRole: "slave",
+		},
+		{
+			name: "both commands fail",
+			node: &mockNodeClient{
+				roleErr: errors.New("connection refused"),
+				infoErr: errors.New("connection refused"),
+			},
+			expectError: true,
+		},
+		{
+			name:        "no role in replication info",
+			node:        &mockNodeClient{roleErr: errors.New("ERR unknown command 'ROLE'"), info: "# Replication\r\n"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := nodeRole(context.Background(), tt.node)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("nodeRole() expected error, got role %q", role)
+				}
+				return
+			}
+			if err != nil || role != tt.expectedRole {
+				t.Errorf("nodeRole() = (%q, %v), want (%q, nil)", role, err, tt.expectedRole)
+			}
+		})
+	}
+}
+
+func TestNodeOptions(t *testing.T) {
+	config := &Config{
+		SentinelUsername: "sentinel-only",
+		SentinelPassword: "sentinel-secret",
+		NodeUsername:     "reconciler",
+		NodePassword:     "node-secret",
+		NodeTLSConfig:    &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	options := nodeOptions(config, "10.244.1.5:6379")
+	if options.Username != "reconciler" || options.Password != "node-secret" {
+		t.Errorf("nodeOptions() credentials = (%q, %q), want the node credentials", options.Username, options.Password)
+	}
+	if options.TLSConfig == nil || options.TLSConfig.ServerName != "10.244.1.5" {
+		t.Errorf("nodeOptions() TLS server name = %v, want 10.244.1.5", options.TLSConfig)
+	}
+
+	config.NodeTLSConfig = nil
+	if options := nodeOptions(config, "10.244.1.5:6379"); options.TLSConfig != nil {
+		t.Errorf("nodeOptions() TLS = %v with node TLS disabled, want nil", options.TLSConfig)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// sentinelSeeds returns the configured sentinel addresses: VALKEY_SENTINEL_ADDRS
+// when set, otherwise VALKEY_SENTINEL_HOST:VALKEY_SENTINEL_PORT.
+func sentinelSeeds(config *Config) []string {
+	if len(config.SentinelAddrs) > 0 {
+		return config.SentinelAddrs
+	}
+	return []string{net.JoinHostPort(config.SentinelHost, config.SentinelPort)}
+}
+
+// sentinelAddresses returns the sentinels to query for masterName. With
+// discovery enabled this is the first sentinel that answers SENTINEL SENTINELS
+// together with the peers it reports; the other seeds are left out since they
+// are likely the same sentinels under another address.
+func sentinelAddresses(ctx context.Context, config *Config, masterName string) []string {
+	seeds := sentinelSeeds(config)
+	if !config.SentinelDiscovery {
+		return seeds
+	}
+
+	for _, seed := range seeds {
+		for _, addr := range resolveSeed(seed) {
+			sentinel := newSentinelClient(config, addr)
+			peers, err := discoverSentinelPeers(ctx, masterName, sentinel)
+			sentinel.Close()
+			if err != nil {
+				slog.Warn("Failed to discover sentinels", logKeyMasterName, masterName, logKeySentinel, addr, logKeyError, err)
+				continue
+			}
+			return uniqueAddresses(append([]string{addr}, peers...))
+		}
+	}
+	return seeds
+}
+
+// resolveSeed returns the addresses of the sentinels behind seed. A headless
+// Service resolves to every sentinel and each new connection to it may reach
+// another one, so discovery talks to a concrete address: the sentinel that
+// answered is then told apart from the peers it reports, and none of them
+// votes twice.
+func resolveSeed(seed string) []string {
+	host, port, err := net.SplitHostPort(seed)
+	if err != nil || net.ParseIP(host) != nil {
+		return []string{seed}
+	}
+	ips, err := net.LookupHost(host)
+	if err != nil || len(ips) == 0 {
+		return []string{seed}
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, port))
+	}
+	return addrs
+}
+
+// uniqueAddresses returns addrs without repeated entries, keeping the first
+// occurrence of each.
+func uniqueAddresses(addrs []string) []string {
+	seen := make(map[string]bool, len(addrs))
+	unique := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if !seen[addr] {
+			seen[addr] = true
+			unique = append(unique, addr)
+		}
+	}
+	return unique
+}
+
+// discoverSentinelPeers returns the addresses of the other sentinels that
+// monitor masterName, as reported by SENTINEL SENTINELS.
+func discoverSentinelPeers(ctx context.Context, masterName string, sentinel SentinelClient) ([]string, error) {
+	sentinels, err := sentinel.Sentinels(ctx, masterName).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sentinels: %w", err)
+	}
+
+	var peers []string
+	for _, peer := range sentinels {
+		if peer["ip"] == "" || peer["port"] == "" {
+			continue
+		}
+		peers = append(peers, net.JoinHostPort(peer["ip"], peer["port"]))
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+// sentinelQuorum returns how many of total sentinels must agree on the master:
+// VALKEY_SENTINEL_QUORUM when set, otherwise a majority.
+func sentinelQuorum(config *Config, total int) int {
+	if config.SentinelQuorum > 0 {
+		return config.SentinelQuorum
+	}
+	return total/2 + 1
+}
+
+// masterByQuorum asks every sentinel for the address of masterName and returns
+// the address reported by at least quorum of them. Sentinels that cannot be
+// reached count as disagreeing.
+func masterByQuorum(ctx context.Context, masterName string, sentinels map[string]SentinelClient, quorum int) ([]string, error) {
+	if quorum > len(sentinels) {
+		return nil, fmt.Errorf("quorum of %d cannot be reached with %d sentinel(s)", quorum, len(sentinels))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	votes := make(map[string]int)
+	answers := make(map[string][]string)
+	var errs []string
+
+	for addr, sentinel := range sentinels {
+		wg.Add(1)
+		go func(addr string, sentinel SentinelClient) {
+			defer wg.Done()
+			masterAddress, err := getCurrentMasterFromSentinel(ctx, masterName, sentinel)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil || len(masterAddress) < 2 {
+				errs = append(errs, fmt.Sprintf("%s: %v", addr, err))
+				return
+			}
+			key := net.JoinHostPort(masterAddress[0], masterAddress[1])
+			votes[key]++
+			answers[key] = masterAddress
+		}(addr, sentinel)
+	}
+	wg.Wait()
+
+	// With a quorum below a majority two addresses can both reach it; only
+	// an outright winner is trusted.
+	best, tied := "", false
+	for key, count := range votes {
+		switch {
+		case best == "" || count > votes[best]:
+			best, tied = key, false
+		case count == votes[best]:
+			tied = true
+		}
+	}
+	if best != "" && !tied && votes[best] >= quorum {
+		return answers[best], nil
+	}
+
+	reported := make([]string, 0, len(votes))
+	for key, count := range votes {
+		reported = append(reported, fmt.Sprintf("%s (%d)", key, count))
+	}
+	sort.Strings(reported)
+	sort.Strings(errs)
+	return nil, fmt.Errorf("no master address for %s reported by %d of %d sentinels: answers [%s], errors [%s]",
+		masterName, quorum, len(sentinels), strings.Join(reported, ", "), strings.Join(errs, "; "))
+}
+
+// confirmMaster waits for a quorum of sentinels to agree with the master
+// address reported in a switch-master event. If they settle on a different
+// address, or never agree on the reported one, the quorum answer wins.
+func confirmMaster(ctx context.Context, config *Config, masterName string, reported []string) ([]string, error) {
+	var masterAddress []string
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, reconcileBackoff, func(ctx context.Context) (bool, error) {
+		masterAddress, lastErr = getCurrentMaster(ctx, config, masterName)
+		if lastErr != nil {
+			return false, nil
+		}
+		return strings.Join(masterAddress, ":") == strings.Join(reported, ":"), nil
+	})
+	if err == nil {
+		return masterAddress, nil
+	}
+	if masterAddress != nil && lastErr == nil {
+		slog.Warn("Sentinel quorum disagrees with the switch-master event", logKeyMasterName, masterName,
+			logKeyMasterAddr, masterAddr(masterAddress), "reported_master_addr", masterAddr(reported))
+		return masterAddress, nil
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, err
+}
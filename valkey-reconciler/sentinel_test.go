@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestMasterByQuorum(t *testing.T) {
+	primary := []string{"10.244.1.5", "6379"}
+	stale := []string{"10.244.1.6", "6379"}
+	down := fmt.Errorf("connection refused")
+
+	tests := []struct {
+		name         string
+		answers      []*mockSentinelClient
+		quorum       int
+		expectedAddr []string
+		expectError  bool
+	}{
+		{
+			name:         "all sentinels agree",
+			answers:      []*mockSentinelClient{{masterAddr: primary}, {masterAddr: primary}, {masterAddr: primary}},
+			quorum:       2,
+			expectedAddr: primary,
+		},
+		{
+			name:         "partitioned sentinel is outvoted",
+			answers:      []*mockSentinelClient{{masterAddr: primary}, {masterAddr: stale}, {masterAddr: primary}},
+			quorum:       2,
+			expectedAddr: primary,
+		},
+		{
+			name:         "unreachable sentinels do not block a quorum",
+			answers:      []*mockSentinelClient{{masterAddr: primary}, {err: down}, {masterAddr: primary}},
+			quorum:       2,
+			expectedAddr: primary,
+		},
+		{
+			name:        "no quorum",
+			answers:     []*mockSentinelClient{{masterAddr: primary}, {masterAddr: stale}, {err: down}},
+			quorum:      2,
+			expectError: true,
+		},
+		{
+			name:        "tie below a majority quorum",
+			answers:     []*mockSentinelClient{{masterAddr: primary}, {masterAddr: stale}},
+			quorum:      1,
+			expectError: true,
+		},
+		{
+			name:        "quorum larger than the number of sentinels",
+			answers:     []*mockSentinelClient{{masterAddr: primary}},
+			quorum:      2,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sentinels := make(map[string]SentinelClient, len(tt.answers))
+			for i, answer := range tt.answers {
+				sentinels[fmt.Sprintf("10.244.0.%d:26379", i+1)] = answer
+			}
+
+			addr, err := masterByQuorum(context.Background(), "myprimary", sentinels, tt.quorum)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("masterByQuorum() = %v, want error", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("masterByQuorum() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(addr, tt.expectedAddr) {
+				t.Errorf("masterByQuorum() = %v, want %v", addr, tt.expectedAddr)
+			}
+		})
+	}
+}
+
+func TestSentinelQuorum(t *testing.T) {
+	tests := []struct {
+		configured int
+		total      int
+		expected   int
+	}{
+		{configured: 0, total: 1, expected: 1},
+		{configured: 0, total: 3, expected: 2},
+		{configured: 0, total: 4, expected: 3},
+		{configured: 1, total: 3, expected: 1},
+	}
+
+	for _, tt := range tests {
+		config := &Config{SentinelQuorum: tt.configured}
+		if got := sentinelQuorum(config, tt.total); got != tt.expected {
+			t.Errorf("sentinelQuorum(%d configured, %d total) = %d, want %d", tt.configured, tt.total, got, tt.expected)
+		}
+	}
+}
+
+func TestDiscoverSentinelPeers(t *testing.T) {
+	mockSentinel := &mockSentinelClient{
+		sentinels: []map[string]string{
+			{"name": "b", "ip": "10.244.0.3", "port": "26379"},
+			{"name": "a", "ip": "10.244.0.2", "port": "26379"},
+			{"name": "incomplete", "ip": "10.244.0.4"},
+		},
+	}
+
+	peers, err := discoverSentinelPeers(context.Background(), "myprimary", mockSentinel)
+	if err != nil {
+		t.Fatalf("discoverSentinelPeers() unexpected error: %v", err)
+	}
+	expected := []string{"10.244.0.2:26379", "10.244.0.3:26379"}
+	if !reflect.DeepEqual(peers, expected) {
+		t.Errorf("discoverSentinelPeers() = %v, want %v", peers, expected)
+	}
+
+	mockSentinel.err = fmt.Errorf("connection refused")
+	if _, err := discoverSentinelPeers(context.Background(), "myprimary", mockSentinel); err == nil {
+		t.Errorf("discoverSentinelPeers() expected error when sentinel is unreachable")
+	}
+}
+
+func TestSentinelSeeds(t *testing.T) {
+	config := &Config{SentinelHost: "vk-valkey", SentinelPort: "26379"}
+	if got := sentinelSeeds(config); !reflect.DeepEqual(got, []string{"vk-valkey:26379"}) {
+		t.Errorf("sentinelSeeds() without addresses = %v, want [vk-valkey:26379]", got)
+	}
+
+	config.SentinelAddrs = []string{"10.244.0.2:26379", "10.244.0.3:26379"}
+	if got := sentinelSeeds(config); !reflect.DeepEqual(got, config.SentinelAddrs) {
+		t.Errorf("sentinelSeeds() = %v, want %v", got, config.SentinelAddrs)
+	}
+}
+
+func TestResolveSeed(t *testing.T) {
+	if got := resolveSeed("10.244.0.2:26379"); !reflect.DeepEqual(got, []string{"10.244.0.2:26379"}) {
+		t.Errorf("resolveSeed() for an IP = %v, want it unchanged", got)
+	}
+	if got := resolveSeed("vk-valkey.invalid:26379"); !reflect.DeepEqual(got, []string{"vk-valkey.invalid:26379"}) {
+		t.Errorf("resolveSeed() for an unresolvable host = %v, want it unchanged", got)
+	}
+
+	got := resolveSeed("localhost:26379")
+	if len(got) == 0 {
+		t.Fatal("resolveSeed() for localhost returned no addresses")
+	}
+	for _, addr := range got {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) == nil || port != "26379" {
+			t.Errorf("resolveSeed() for localhost = %v, want IP addresses on port 26379", got)
+		}
+	}
+}
+
+func TestUniqueAddresses(t *testing.T) {
+	got := uniqueAddresses([]string{"10.244.0.2:26379", "10.244.0.3:26379", "10.244.0.2:26379"})
+	want := []string{"10.244.0.2:26379", "10.244.0.3:26379"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueAddresses() = %v, want %v", got, want)
+	}
+}
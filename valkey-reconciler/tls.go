@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves the CA bundle and client key pair for sentinel or node
+// connections, reading them again whenever one of the files changes on disk so
+// that a rotated Kubernetes secret is picked up without a restart.
+type certReloader struct {
+	// name says which connections use the files in log messages, e.g.
+	// "sentinel".
+	name string
+
+	caFile   string
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+	roots    *x509.CertPool
+	cert     *tls.Certificate
+}
+
+// reload reads the CA bundle and key pair again when filesChanged reports a
+// change. On error the previously loaded material is kept.
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, changed, err := filesChanged(r.modTimes, r.caFile, r.certFile, r.keyFile)
+	if err != nil || !changed {
+		return err
+	}
+
+	var roots *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &pair
+	}
+
+	if r.modTimes != nil {
+		slog.Info(fmt.Sprintf("Reloaded %s TLS certificates", r.name))
+	}
+	r.modTimes = modTimes
+	r.roots = roots
+	r.cert = cert
+	return nil
+}
+
+func (r *certReloader) rootCAs() *x509.CertPool {
+	if err := r.reload(); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to reload %s CA bundle, using the previous one", r.name), logKeyError, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roots
+}
+
+func (r *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if err := r.reload(); err != nil {
+		slog.Warn(fmt.Sprintf("Failed to reload %s client certificate, using the previous one", r.name), logKeyError, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return r.cert, nil
+}
+
+// newSentinelTLSConfig builds the TLS configuration shared by every sentinel
+// connection, or returns nil when TLS is disabled. Connections use it through
+// sentinelTLSConfig, which adds the name to verify.
+func newSentinelTLSConfig(config *Config) (*tls.Config, error) {
+	if !config.SentinelTLS {
+		return nil, nil
+	}
+	return newTLSConfig(config, "sentinel", config.SentinelServerName)
+}
+
+// newNodeTLSConfig builds the TLS configuration for connections to the Valkey
+// nodes, or returns nil when TLS is disabled for them. It shares the CA bundle
+// and client certificate with the sentinel connections.
+func newNodeTLSConfig(config *Config) (*tls.Config, error) {
+	if !config.NodeTLS {
+		return nil, nil
+	}
+	return newTLSConfig(config, "node", config.NodeServerName)
+}
+
+// newTLSConfig builds a TLS configuration from the sentinel TLS files that
+// verifies serverName, or the dialed host when serverName is empty. name says
+// which connections use it in log messages.
+func newTLSConfig(config *Config, name, serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	reloader := &certReloader{
+		name:     name,
+		caFile:   config.SentinelTLSCAFile,
+		certFile: config.SentinelTLSCertFile,
+		keyFile:  config.SentinelTLSKeyFile,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load %s TLS files: %w", name, err)
+	}
+
+	if config.SentinelTLSCertFile != "" {
+		tlsConfig.GetClientCertificate = reloader.clientCertificate
+	}
+
+	switch {
+	case config.SentinelTLSInsecure:
+		tlsConfig.InsecureSkipVerify = true
+	case config.SentinelTLSCAFile != "":
+		// The standard verification reads RootCAs once per tls.Config, so
+		// the chain is verified here against the current bundle instead.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPeer(state, reloader.rootCAs())
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// sentinelTLSConfig returns the TLS configuration for a connection to addr, or
+// nil when TLS is disabled. The certificate is verified against
+// VALKEY_SENTINEL_TLS_SERVER_NAME when set, otherwise against the dialed host,
+// which may be an IP address.
+func sentinelTLSConfig(config *Config, addr string) *tls.Config {
+	return connectionTLSConfig(config.SentinelTLSConfig, addr)
+}
+
+// connectionTLSConfig returns a copy of base for a connection to addr that
+// verifies the configured server name or, without one, the dialed host.
+func connectionTLSConfig(base *tls.Config, addr string) *tls.Config {
+	if base == nil {
+		return nil
+	}
+
+	tlsConfig := base.Clone()
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		tlsConfig.ServerName = host
+	}
+
+	// The handshake only reports the name it sent as SNI, which is empty for
+	// IP addresses, so the name is filled in for verifyPeer.
+	if verify := tlsConfig.VerifyConnection; verify != nil {
+		serverName := tlsConfig.ServerName
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			state.ServerName = serverName
+			return verify(state)
+		}
+	}
+	return tlsConfig
+}
+
+// verifyPeer verifies the server certificate chain of state against roots and
+// the server name the connection was made to.
+func verifyPeer(state tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("sentinel presented no certificate")
+	}
+	if state.ServerName == "" {
+		return errors.New("no server name to verify the sentinel certificate against")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       state.ServerName,
+	})
+	return err
+}
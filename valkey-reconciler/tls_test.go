@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for name, which is either a DNS name or an IP
+// address.
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake connects a client using clientConfig to a local server presenting
+// serverCert and returns the client's handshake error.
+func handshake(t *testing.T, clientConfig *tls.Config, serverCert tls.Certificate) error {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+
+	config := clientConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = "vk-valkey"
+	}
+	conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestNewSentinelTLSConfigDisabled(t *testing.T) {
+	tlsConfig, err := newSentinelTLSConfig(&Config{SentinelTLS: false})
+	if err != nil || tlsConfig != nil {
+		t.Errorf("newSentinelTLSConfig() with TLS disabled = (%v, %v), want (nil, nil)", tlsConfig, err)
+	}
+}
+
+func TestNewSentinelTLSConfigReloadsCA(t *testing.T) {
+	first := newTestCA(t, "first")
+	second := newTestCA(t, "second")
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, first.pem, 0o600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+
+	tlsConfig, err := newSentinelTLSConfig(&Config{SentinelTLS: true, SentinelTLSCAFile: caFile})
+	if err != nil {
+		t.Fatalf("newSentinelTLSConfig() unexpected error: %v", err)
+	}
+
+	if err := handshake(t, tlsConfig, first.issue(t, "vk-valkey")); err != nil {
+		t.Errorf("handshake with server signed by the configured CA failed: %v", err)
+	}
+	if err := handshake(t, tlsConfig, first.issue(t, "elsewhere")); err == nil {
+		t.Errorf("handshake with a certificate for another name succeeded, want error")
+	}
+	if err := handshake(t, tlsConfig, second.issue(t, "vk-valkey")); err == nil {
+		t.Errorf("handshake with server signed by an unknown CA succeeded, want error")
+	}
+
+	// Rotate the bundle, as kubelet does when the mounted secret changes.
+	if err := os.WriteFile(caFile, second.pem, 0o600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(caFile, future, future); err != nil {
+		t.Fatalf("failed to touch CA bundle: %v", err)
+	}
+
+	if err := handshake(t, tlsConfig, second.issue(t, "vk-valkey")); err != nil {
+		t.Errorf("handshake after CA rotation failed: %v", err)
+	}
+}
+
+func TestSentinelTLSConfigVerifiesDialedHost(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatalf("failed to write CA bundle: %v", err)
+	}
+
+	config := &Config{SentinelTLS: true, SentinelTLSCAFile: caFile}
+	var err error
+	if config.SentinelTLSConfig, err = newSentinelTLSConfig(config); err != nil {
+		t.Fatalf("newSentinelTLSConfig() unexpected error: %v", err)
+	}
+
+	// Sentinels dialed by IP send no SNI; the IP itself must be verified.
+	byIP := sentinelTLSConfig(config, "127.0.0.1:26379")
+	if err := handshake(t, byIP, ca.issue(t, "vk-valkey")); err == nil {
+		t.Errorf("handshake with 127.0.0.1 and a certificate for vk-valkey succeeded, want error")
+	}
+	if err := handshake(t, byIP, ca.issue(t, "127.0.0.1")); err != nil {
+		t.Errorf("handshake with 127.0.0.1 and a certificate for 127.0.0.1 failed: %v", err)
+	}
+
+	// The configured server name overrides the dialed host.
+	config.SentinelServerName = "vk-valkey"
+	if config.SentinelTLSConfig, err = newSentinelTLSConfig(config); err != nil {
+		t.Fatalf("newSentinelTLSConfig() unexpected error: %v", err)
+	}
+	byName := sentinelTLSConfig(config, "127.0.0.1:26379")
+	if err := handshake(t, byName, ca.issue(t, "vk-valkey")); err != nil {
+		t.Errorf("handshake with server name vk-valkey failed: %v", err)
+	}
+	if err := handshake(t, byName, ca.issue(t, "elsewhere")); err == nil {
+		t.Errorf("handshake with server name vk-valkey and a certificate for elsewhere succeeded, want error")
+	}
+}
+
+func TestNewSentinelTLSConfigInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{name: "missing CA bundle", config: &Config{SentinelTLS: true, SentinelTLSCAFile: filepath.Join(dir, "missing.crt")}},
+		{name: "CA bundle without certificates", config: &Config{SentinelTLS: true, SentinelTLSCAFile: notPEM}},
+		{name: "invalid client key pair", config: &Config{SentinelTLS: true, SentinelTLSCertFile: notPEM, SentinelTLSKeyFile: notPEM}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSentinelTLSConfig(tt.config); err == nil {
+				t.Errorf("newSentinelTLSConfig() expected error, but got none")
+			}
+		})
+	}
+}